@@ -7,16 +7,16 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hidu/es-tools/internal"
 )
@@ -38,6 +38,11 @@ type Config struct {
 	OriginIndex *IndexInfo      `json:"origin_index"`
 	ScanQuery   *internal.Query `json:"scan_query"`
 	ScanTime    string          `json:"scan_time"`
+
+	// Output 输出的文件，未配置时输出到 stdout
+	Output *OutputConfig `json:"output"`
+
+	scanTime int // scan_time 的秒数
 }
 
 // String 序列化
@@ -50,46 +55,105 @@ func (c *Config) String() string {
 }
 
 var conf = flag.String("conf", "es_dump.json", "config file name")
+var checkpointFile = flag.String("checkpoint", "", "checkpoint file, read with search_after and save the progress to it")
+var resume = flag.Bool("resume", false, "resume from the checkpoint file")
+var slices = flag.Int("slices", 1, "sliced scroll num, read in parallel")
+var readerKind = flag.String("reader", internal.ReaderAuto, "read with: auto, scroll, pit(point in time, es >= 7.12)")
+var format = flag.String("format", "", "output format: ndjson, bulk, csv, tsv, parquet, overwrite the output.format in config")
+
+// readers 正在使用的 Reader，退出前需要关闭
+var readers []internal.Reader
 
 func main() {
 	flag.Parse()
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	if *resume && *checkpointFile == "" {
+		log.Fatalln("-resume requires -checkpoint")
+	}
+
 	conf, err := readConf(*conf)
 	if err != nil {
 		log.Fatalln("parser config failed:", err)
 	}
 
+	readers, err = internal.NewReaders(conf.OriginIndex.Host, conf.OriginIndex.DocType, conf.ScanQuery, &internal.ReaderOption{
+		Kind:     *readerKind,
+		Slices:   *slices,
+		ScanTime: conf.scanTime,
+	})
+	checkErr("create reader failed", err)
+	if *checkpointFile != "" {
+		err = readers[0].EnableCheckpoint(*checkpointFile, *resume)
+		checkErr("enable checkpoint failed", err)
+	}
+	if conf.Output.Format == FormatParquet {
+		checkErr("read mapping failed", conf.Output.Parquet.loadMapping(conf.OriginIndex.Host, conf.OriginIndex.DocType.Index))
+	}
+	out, err := newOutput(conf.Output, conf.OriginIndex.DocType.Index, *resume)
+	checkErr("create output failed", err)
+	if *checkpointFile != "" {
+		// 文件记录到清单后立即保存断点，减少被 kill 后 -resume 重复写入的数据
+		out.afterAcks = func() {
+			for _, r := range readers {
+				if err := r.SaveCheckpoint(); err != nil {
+					log.Println("save checkpoint failed:", err)
+				}
+			}
+		}
+	}
+
+	stop := make(chan struct{})
+	internal.HandleSignal(func() {
+		close(stop)
+	}, closeReaders, nil)
+
 	scrollResultChan := make(chan *internal.ScrollResponse, 100)
 
 	var wg sync.WaitGroup
 
 	wg.Add(1)
 	go func() {
-		writer := bufio.NewWriter(os.Stdout)
 		for job := range scrollResultChan {
-			dumpToWriter(writer, job)
-		}
-		if err := writer.Flush(); err != nil {
-			log.Printf("writer.Flush() has error: %v", err)
+			checkErr("write output failed", dumpTo(out, job))
+			if *checkpointFile == "" {
+				continue
+			}
+			// 数据所在的文件记录到清单后才能确认
+			job := job
+			checkErr("flush output failed", out.Ack(func() {
+				if err := readers[job.Slice()].Ack(job); err != nil {
+					log.Println("save checkpoint failed:", err)
+				}
+			}))
 		}
 		wg.Done()
 	}()
 
-	scroll := internal.NewScroll(conf.OriginIndex.Host, conf.OriginIndex.DocType, conf.ScanQuery)
-	for {
-		sr, err := scroll.Next()
-		checkErr("scroll_next, err=", err)
-
+	err = internal.ReadSlices(readers, func(sr *internal.ScrollResponse) bool {
 		scrollResultChan <- sr
-		if !sr.HasMore() {
-			log.Println("scroll finish, no more message")
-			break
-		}
+		return !internal.IsStopped(stop)
+	})
+	checkErr("scroll_next, err=", err)
+
+	interrupted := internal.IsStopped(stop)
+	if interrupted {
+		log.Println("scroll stopped, wait output")
+	} else {
+		log.Println("scroll finish, no more message")
 	}
+
 	close(scrollResultChan)
 	wg.Wait()
 
+	checkErr("close output failed", out.Close(!interrupted))
+
+	closeReaders()
+
+	if interrupted {
+		log.Println("dump interrupted")
+		os.Exit(internal.ExitInterrupted)
+	}
 	log.Println("dump finish")
 }
 
@@ -108,6 +172,11 @@ func readConf(confName string) (*Config, error) {
 	if conf.ScanTime == "" {
 		conf.ScanTime = "120s"
 	}
+	scanTime, err := time.ParseDuration(conf.ScanTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scan_time %q: %w", conf.ScanTime, err)
+	}
+	conf.scanTime = int(scanTime.Seconds())
 
 	if conf.OriginIndex == nil {
 		log.Fatalln("origin_index is empty")
@@ -119,18 +188,49 @@ func readConf(confName string) (*Config, error) {
 	if conf.ScanQuery == nil {
 		conf.ScanQuery = internal.NewQuery()
 	}
+
+	if conf.Output == nil {
+		conf.Output = &OutputConfig{}
+	}
+	if *format != "" {
+		conf.Output.Format = *format
+	}
+	if err = conf.Output.init(); err != nil {
+		return nil, err
+	}
+	if *checkpointFile != "" && conf.Output.Format == FormatParquet {
+		return nil, fmt.Errorf("parquet format does not support -checkpoint, the data is written when the row group or file is finished")
+	}
+	if *checkpointFile != "" && conf.Output.Path != "" && !strings.Contains(conf.Output.Path, "{part}") {
+		return nil, fmt.Errorf("output.path should contains {part} when use -checkpoint, the dump continues with a new file after -resume")
+	}
 	return conf, nil
 }
 
 func checkErr(msg string, err error) {
 	if err != nil {
+		closeReaders()
 		log.Fatalln(msg, err)
 	}
 }
 
-func dumpToWriter(writer io.Writer, scrollResult *internal.ScrollResponse) {
+// closeReaders 保存断点，并清除 scroll 上下文或关闭 point in time
+func closeReaders() {
+	for _, r := range readers {
+		if err := r.SaveCheckpoint(); err != nil {
+			log.Println("save checkpoint failed:", err)
+		}
+		if err := r.Close(); err != nil {
+			log.Println("close reader failed:", err)
+		}
+	}
+}
+
+func dumpTo(out *output, scrollResult *internal.ScrollResponse) error {
 	for _, item := range scrollResult.Hits.Hits {
-		writer.Write(item.JSONBytes())
-		writer.Write([]byte("\n"))
+		if err := out.Write(item); err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -0,0 +1,119 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// 输出的格式
+const (
+	// FormatNDJSON 每行一条数据，包括 _index、_type、_id、_source 等
+	FormatNDJSON = "ndjson"
+
+	// FormatBulk bulk 请求的格式，可以直接使用 _bulk 接口写入
+	FormatBulk = "bulk"
+
+	// FormatCSV 按 csv 配置的列输出，逗号分隔
+	FormatCSV = "csv"
+
+	// FormatTSV 同 csv，使用 tab 分隔
+	FormatTSV = "tsv"
+
+	// FormatParquet parquet 文件
+	FormatParquet = "parquet"
+)
+
+// BulkOutputConfig format 为 bulk 时的配置
+type BulkOutputConfig struct {
+	// Index 写入的索引名，为空时使用原索引名
+	Index string `json:"index"`
+
+	// Type 写入的 type，为空时使用原 type
+	Type string `json:"type"`
+
+	// RemoveType 为 true 时不输出 _type，用于写入不支持 _type 的 es 7.x/8.x
+	RemoveType bool `json:"remove_type"`
+
+	// OpType bulk 的操作类型：index、create、update、delete，默认为 index
+	OpType string `json:"op_type"`
+}
+
+func (c *BulkOutputConfig) init() error {
+	if c.RemoveType && c.Type != "" {
+		return fmt.Errorf("output.bulk.remove_type can not be used with output.bulk.type")
+	}
+	return internal.CheckOpType(c.OpType)
+}
+
+// encoder 将一条数据编码为输出的内容
+type encoder interface {
+	Encode(item *internal.DataItem) ([]byte, error)
+}
+
+// headerEncoder 每个文件开始时需要输出表头的 encoder
+type headerEncoder interface {
+	Header() []byte
+}
+
+// fileEncoder 自己写入文件内容的 encoder(如 parquet 的文件末尾有 footer)，
+// Encode 返回的数据不写入文件，只用于统计 max_bytes
+type fileEncoder interface {
+	encoder
+
+	// Begin 开始一个新的文件
+	Begin(w io.Writer) error
+
+	// End 结束当前的文件
+	End() error
+}
+
+func newEncoder(c *OutputConfig) (encoder, error) {
+	switch c.Format {
+	case FormatNDJSON:
+		return ndjsonEncoder{}, nil
+	case FormatBulk:
+		return &bulkEncoder{conf: c.Bulk}, nil
+	case FormatCSV:
+		return &csvEncoder{conf: c.CSV, comma: ','}, nil
+	case FormatTSV:
+		return &csvEncoder{conf: c.CSV, comma: '\t'}, nil
+	case FormatParquet:
+		return newParquetEncoder(c.Parquet), nil
+	default:
+		return nil, fmt.Errorf("invalid format %q, should be one of: ndjson, bulk, csv, tsv, parquet", c.Format)
+	}
+}
+
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) Encode(item *internal.DataItem) ([]byte, error) {
+	return append(item.JSONBytes(), '\n'), nil
+}
+
+type bulkEncoder struct {
+	conf *BulkOutputConfig
+}
+
+func (e *bulkEncoder) Encode(item *internal.DataItem) ([]byte, error) {
+	if e.conf.Index != "" {
+		item.Index = e.conf.Index
+	}
+	if e.conf.Type != "" {
+		item.Type = e.conf.Type
+	}
+	if e.conf.RemoveType {
+		item.Type = ""
+	}
+	if e.conf.OpType != "" {
+		item.OpType = e.conf.OpType
+	}
+	return []byte(item.BulkString()), nil
+}
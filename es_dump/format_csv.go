@@ -0,0 +1,189 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// 数组字段的处理方式
+const (
+	// ArrayJSON 编码为 json
+	ArrayJSON = "json"
+
+	// ArrayJoin 使用 join_separator 连接
+	ArrayJoin = "join"
+
+	// ArrayExplode 展开为多行，每行一个元素
+	ArrayExplode = "explode"
+)
+
+// CSVOutputConfig format 为 csv、tsv 时的配置
+type CSVOutputConfig struct {
+	// Columns 输出的列，为 _source 中字段的路径，如 user.name，
+	// 以及 _id、_index、_type、_routing
+	Columns []string `json:"columns"`
+
+	// Array 数组的处理方式：json、join、explode，默认为 json。对象总是编码为 json
+	Array string `json:"array"`
+
+	// JoinSeparator array 为 join 时的分隔符，默认为 |
+	JoinSeparator string `json:"join_separator"`
+
+	// NoHeader 为 true 时不输出表头，默认每个文件的第一行为表头
+	NoHeader bool `json:"no_header"`
+}
+
+func (c *CSVOutputConfig) init() error {
+	if len(c.Columns) == 0 {
+		return fmt.Errorf("output.csv.columns is empty")
+	}
+	switch c.Array {
+	case "":
+		c.Array = ArrayJSON
+	case ArrayJSON, ArrayJoin, ArrayExplode:
+	default:
+		return fmt.Errorf("invalid output.csv.array %q, should be one of: json, join, explode", c.Array)
+	}
+	if c.JoinSeparator == "" {
+		c.JoinSeparator = "|"
+	}
+	return nil
+}
+
+// csvEncoder 每条数据输出为一行，array 为 explode 时可能输出多行
+type csvEncoder struct {
+	conf  *CSVOutputConfig
+	comma rune
+}
+
+// Header 表头
+func (e *csvEncoder) Header() []byte {
+	if e.conf.NoHeader {
+		return nil
+	}
+	return e.write([][]string{e.conf.Columns})
+}
+
+func (e *csvEncoder) write(rows [][]string) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = e.comma
+	w.WriteAll(rows)
+	return buf.Bytes()
+}
+
+func (e *csvEncoder) Encode(item *internal.DataItem) ([]byte, error) {
+	values := make([]interface{}, len(e.conf.Columns))
+	rowNum := 1
+	for i, col := range e.conf.Columns {
+		values[i] = columnValue(item, col)
+		if arr, ok := values[i].([]interface{}); ok && e.conf.Array == ArrayExplode && len(arr) > rowNum {
+			rowNum = len(arr)
+		}
+	}
+	rows := make([][]string, rowNum)
+	for n := range rows {
+		row := make([]string, len(values))
+		for i, v := range values {
+			if arr, ok := v.([]interface{}); ok && e.conf.Array == ArrayExplode {
+				// 多个数组字段按下标对应展开，较短的数组输出为空
+				v = nil
+				if n < len(arr) {
+					v = arr[n]
+				}
+			}
+			row[i] = e.cell(v)
+		}
+		rows[n] = row
+	}
+	return e.write(rows), nil
+}
+
+func (e *csvEncoder) cell(v interface{}) string {
+	arr, ok := v.([]interface{})
+	if !ok || e.conf.Array != ArrayJoin {
+		return cellString(v)
+	}
+	ss := make([]string, len(arr))
+	for i, v := range arr {
+		ss[i] = cellString(v)
+	}
+	return strings.Join(ss, e.conf.JoinSeparator)
+}
+
+func cellString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		bf, _ := json.Marshal(val)
+		return string(bf)
+	}
+}
+
+// columnValue 列的值，路径中有数组时返回每个元素对应的值组成的数组(元素中没有该字段时为 nil)
+func columnValue(item *internal.DataItem, col string) interface{} {
+	switch col {
+	case "_id":
+		return item.ID
+	case "_index":
+		return item.Index
+	case "_type":
+		return item.Type
+	case "_routing":
+		return item.Routing
+	}
+	return pathValue(item.Source, col)
+}
+
+// pathValue 读取 v 中 path(以 . 分隔) 的值，字段名本身包含 . 时也可以读取
+func pathValue(v interface{}, path string) interface{} {
+	if path == "" {
+		return v
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if sv, has := val[path]; has {
+			return sv
+		}
+		for i := strings.LastIndex(path, "."); i > 0; i = strings.LastIndex(path[:i], ".") {
+			if sv, has := val[path[:i]]; has {
+				return pathValue(sv, path[i+1:])
+			}
+		}
+		return nil
+	case []interface{}:
+		var result []interface{}
+		for _, ev := range val {
+			sv := pathValue(ev, path)
+			if arr, ok := sv.([]interface{}); ok {
+				result = append(result, arr...)
+			} else {
+				result = append(result, sv)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
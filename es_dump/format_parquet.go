@@ -0,0 +1,558 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// parquet 的 schema 来源
+const (
+	// SchemaMapping 字段类型来自索引的 mapping(GET _mapping)
+	SchemaMapping = "mapping"
+
+	// SchemaSample 字段类型依据开始的 sample_size 条数据推断
+	SchemaSample = "sample"
+)
+
+// ParquetOutputConfig format 为 parquet 时的配置
+type ParquetOutputConfig struct {
+	// Schema schema 的来源：mapping、sample，默认为 mapping。
+	// 两种方式都会依据开始的 sample_size 条数据判断哪些字段是数组
+	Schema string `json:"schema"`
+
+	// SampleSize 用于推断 schema 的条数，默认为 1000
+	SampleSize int `json:"sample_size"`
+
+	// RowGroupSize row group 的字节数，默认为 128MB
+	RowGroupSize int64 `json:"row_group_size"`
+
+	// Compression 压缩方式：snappy、gzip、zstd、lz4、none，默认为 snappy
+	Compression string `json:"compression"`
+
+	codec      parquet.CompressionCodec
+	properties map[string]interface{} // mapping 中的 properties
+}
+
+func (c *ParquetOutputConfig) init() error {
+	switch c.Schema {
+	case "":
+		c.Schema = SchemaMapping
+	case SchemaMapping, SchemaSample:
+	default:
+		return fmt.Errorf("invalid output.parquet.schema %q, should be one of: mapping, sample", c.Schema)
+	}
+	if c.SampleSize <= 0 {
+		c.SampleSize = 1000
+	}
+	if c.RowGroupSize <= 0 {
+		c.RowGroupSize = 128 * 1024 * 1024
+	}
+	switch c.Compression {
+	case "", "snappy":
+		c.codec = parquet.CompressionCodec_SNAPPY
+	case "gzip":
+		c.codec = parquet.CompressionCodec_GZIP
+	case "zstd":
+		c.codec = parquet.CompressionCodec_ZSTD
+	case "lz4":
+		c.codec = parquet.CompressionCodec_LZ4
+	case "none":
+		c.codec = parquet.CompressionCodec_UNCOMPRESSED
+	default:
+		return fmt.Errorf("invalid output.parquet.compression %q, should be one of: snappy, gzip, zstd, lz4, none", c.Compression)
+	}
+	return nil
+}
+
+// loadMapping schema 为 mapping 时读取索引的 mapping
+func (c *ParquetOutputConfig) loadMapping(host *internal.Host, index string) error {
+	if c.Schema != SchemaMapping {
+		return nil
+	}
+	var err error
+	c.properties, err = host.MappingProperties(index)
+	return err
+}
+
+// parquet 字段的类型
+const (
+	pqString = "string"
+	pqInt64  = "int64"
+	pqDouble = "double"
+	pqBool   = "bool"
+	pqObject = "object"
+)
+
+// pqField parquet 中的一个字段，所有字段都是可选的
+type pqField struct {
+	name   string
+	path   string // 完整的路径，用于日志
+	kind   string
+	list   bool
+	fields []*pqField // kind 为 object 时的子字段
+	byName map[string]*pqField
+}
+
+func newPQField(name string, parent string) *pqField {
+	path := name
+	if parent != "" {
+		path = parent + "." + name
+	}
+	return &pqField{
+		name:   name,
+		path:   path,
+		byName: make(map[string]*pqField),
+	}
+}
+
+func (f *pqField) child(name string) *pqField {
+	if c, has := f.byName[name]; has {
+		return c
+	}
+	c := newPQField(name, f.path)
+	f.byName[name] = c
+	return c
+}
+
+// fromMapping 依据 mapping 中的 properties 设置子字段的类型，
+// text、keyword、date 等为 string，不支持的类型(如 geo_point)编码为 json 字符串
+func (f *pqField) fromMapping(props map[string]interface{}) {
+	f.kind = pqObject
+	for name, v := range props {
+		pm, _ := v.(map[string]interface{})
+		typ, _ := pm["type"].(string)
+		if typ == "alias" {
+			continue
+		}
+		c := f.child(name)
+		if sub, ok := pm["properties"].(map[string]interface{}); ok && (typ == "" || typ == "object" || typ == "nested") {
+			c.fromMapping(sub)
+			c.list = typ == "nested"
+			continue
+		}
+		switch typ {
+		case "long", "integer", "short", "byte":
+			c.kind = pqInt64
+		case "double", "float", "half_float", "scaled_float":
+			c.kind = pqDouble
+		case "boolean":
+			c.kind = pqBool
+		default:
+			c.kind = pqString
+		}
+	}
+}
+
+// sample 依据数据推断类型，mapping 中已有的字段只判断是否为数组
+func (f *pqField) sample(v interface{}, typed bool) {
+	if arr, ok := v.([]interface{}); ok {
+		if len(arr) > 0 {
+			f.list = true
+		}
+		for _, ev := range arr {
+			f.sample(ev, typed)
+		}
+		return
+	}
+	if v == nil {
+		return
+	}
+	if typed && f.kind != "" {
+		if m, ok := v.(map[string]interface{}); ok && f.kind == pqObject {
+			for name, sv := range m {
+				if c, has := f.byName[name]; has {
+					c.sample(sv, true)
+				}
+			}
+		}
+		return
+	}
+	kind := valueKind(v)
+	switch {
+	case f.kind == "":
+		f.kind = kind
+	case f.kind == kind:
+	case (f.kind == pqInt64 && kind == pqDouble) || (f.kind == pqDouble && kind == pqInt64):
+		f.kind = pqDouble
+	default:
+		f.kind = pqString
+	}
+	if m, ok := v.(map[string]interface{}); ok && f.kind == pqObject {
+		for name, sv := range m {
+			f.child(name).sample(sv, false)
+		}
+	}
+}
+
+func valueKind(v interface{}) string {
+	switch val := v.(type) {
+	case json.Number:
+		if _, err := val.Int64(); err == nil {
+			return pqInt64
+		}
+		return pqDouble
+	case float64:
+		if val == math.Trunc(val) {
+			return pqInt64
+		}
+		return pqDouble
+	case bool:
+		return pqBool
+	case map[string]interface{}:
+		return pqObject
+	default:
+		return pqString
+	}
+}
+
+// build 确定最终的字段：没有类型的字段(只有 null)忽略，没有子字段的 object 使用 json 字符串，
+// 字段名不能作为 parquet 字段名或者与其他字段冲突时忽略
+func (f *pqField) build() {
+	names := make([]string, 0, len(f.byName))
+	for name := range f.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	inNames := make(map[string]string)
+	f.fields = nil
+	for _, name := range names {
+		c := f.byName[name]
+		if c.kind == "" {
+			log.Printf("parquet: field %s has no value in samples, ignored\n", c.path)
+			continue
+		}
+		if name == "" || strings.ContainsAny(name, ",= \t\n") {
+			log.Printf("parquet: field %s can not be used as a parquet column name, ignored\n", c.path)
+			continue
+		}
+		inName := common.StringToVariableName(name)
+		if other, has := inNames[inName]; has {
+			log.Printf("parquet: field %s conflicts with %s, ignored\n", c.path, other)
+			continue
+		}
+		inNames[inName] = name
+		if c.kind == pqObject {
+			c.build()
+			if len(c.fields) == 0 {
+				c.kind = pqString
+			}
+		}
+		f.fields = append(f.fields, c)
+	}
+}
+
+// schema parquet-go 的 json schema
+func (f *pqField) schema(name string, repetition string) map[string]interface{} {
+	if f.list {
+		elem := *f
+		elem.list = false
+		return map[string]interface{}{
+			"Tag":    fmt.Sprintf("name=%s, type=LIST, repetitiontype=%s", name, repetition),
+			"Fields": []interface{}{elem.schema("element", "REQUIRED")},
+		}
+	}
+	tag := fmt.Sprintf("name=%s, repetitiontype=%s", name, repetition)
+	switch f.kind {
+	case pqObject:
+		fields := make([]interface{}, 0, len(f.fields))
+		for _, c := range f.fields {
+			fields = append(fields, c.schema(c.name, "OPTIONAL"))
+		}
+		return map[string]interface{}{
+			"Tag":    tag,
+			"Fields": fields,
+		}
+	case pqInt64:
+		tag += ", type=INT64"
+	case pqDouble:
+		tag += ", type=DOUBLE"
+	case pqBool:
+		tag += ", type=BOOLEAN"
+	default:
+		tag += ", type=BYTE_ARRAY, convertedtype=UTF8"
+	}
+	return map[string]interface{}{
+		"Tag": tag,
+	}
+}
+
+// parquetEncoder 输出为 parquet 文件，开始的 sample_size 条数据缓存在内存中，确定 schema 后再写入
+type parquetEncoder struct {
+	conf    *ParquetOutputConfig
+	root    *pqField
+	schema  string
+	samples []map[string]interface{}
+	w       io.Writer
+	pw      *writer.JSONWriter
+	warned  map[string]bool
+}
+
+func newParquetEncoder(c *ParquetOutputConfig) *parquetEncoder {
+	return &parquetEncoder{
+		conf:   c,
+		warned: make(map[string]bool),
+	}
+}
+
+// record 一条数据：_id、_index 以及 _source 中的字段，字段名中的 . 展开为对象
+func (e *parquetEncoder) record(item *internal.DataItem) map[string]interface{} {
+	rec := expandDots(item.Source)
+	rec["_id"] = item.ID
+	rec["_index"] = item.Index
+	return rec
+}
+
+// initSchema 依据 mapping 和缓存的数据确定 schema
+func (e *parquetEncoder) initSchema() error {
+	root := newPQField("", "")
+	root.kind = pqObject
+	typed := e.conf.properties != nil
+	if typed {
+		root.fromMapping(e.conf.properties)
+	}
+	root.child("_id").kind = pqString
+	root.child("_index").kind = pqString
+	for _, rec := range e.samples {
+		root.sample(rec, typed)
+	}
+	root.build()
+	bf, err := json.Marshal(root.schema("parquet_go_root", "REQUIRED"))
+	if err != nil {
+		return err
+	}
+	e.root = root
+	e.schema = string(bf)
+	return nil
+}
+
+// Begin 开始一个新的文件
+func (e *parquetEncoder) Begin(w io.Writer) error {
+	e.w = w
+	if e.root == nil {
+		return nil
+	}
+	return e.newWriter()
+}
+
+func (e *parquetEncoder) newWriter() error {
+	var err error
+	if e.pw, err = writer.NewJSONWriterFromWriter(e.schema, e.w, 4); err != nil {
+		return err
+	}
+	e.pw.RowGroupSize = e.conf.RowGroupSize
+	e.pw.CompressionType = e.conf.codec
+	return nil
+}
+
+// Encode 写入一条数据，返回 json 编码后的数据，只用于统计大小
+func (e *parquetEncoder) Encode(item *internal.DataItem) ([]byte, error) {
+	rec := e.record(item)
+	if e.root == nil {
+		e.samples = append(e.samples, rec)
+		if len(e.samples) < e.conf.SampleSize {
+			return item.JSONBytes(), nil
+		}
+		if err := e.flushSamples(); err != nil {
+			return nil, err
+		}
+		return item.JSONBytes(), nil
+	}
+	return e.write(rec)
+}
+
+func (e *parquetEncoder) flushSamples() error {
+	if err := e.initSchema(); err != nil {
+		return err
+	}
+	if err := e.newWriter(); err != nil {
+		return err
+	}
+	for _, rec := range e.samples {
+		if _, err := e.write(rec); err != nil {
+			return err
+		}
+	}
+	e.samples = nil
+	return nil
+}
+
+func (e *parquetEncoder) write(rec map[string]interface{}) ([]byte, error) {
+	v, _ := e.convert(e.root, rec)
+	bf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.pw.Write(string(bf)); err != nil {
+		return nil, err
+	}
+	return bf, nil
+}
+
+// End 写入缓存的数据和文件的 footer
+func (e *parquetEncoder) End() error {
+	if e.root == nil {
+		if err := e.flushSamples(); err != nil {
+			return err
+		}
+	}
+	err := e.pw.WriteStop()
+	e.pw = nil
+	return err
+}
+
+// warn 每个字段的每种问题只输出一次日志
+func (e *parquetEncoder) warn(f *pqField, msg string) {
+	key := f.path + "|" + msg
+	if !e.warned[key] {
+		e.warned[key] = true
+		log.Printf("parquet: field %s %s\n", f.path, msg)
+	}
+}
+
+// convert 将 v 转换为字段类型的值，不能转换时返回 false
+func (e *parquetEncoder) convert(f *pqField, v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	arr, isArr := v.([]interface{})
+	if f.list {
+		if !isArr {
+			arr = []interface{}{v}
+		}
+		var result []interface{}
+		for _, ev := range flatten(arr) {
+			if cv, ok := e.convertOne(f, ev); ok {
+				result = append(result, cv)
+			}
+		}
+		return result, len(result) > 0
+	}
+	if isArr {
+		if f.kind == pqString {
+			return cellString(v), true
+		}
+		arr = flatten(arr)
+		if len(arr) == 0 {
+			return nil, false
+		}
+		if len(arr) > 1 {
+			e.warn(f, "has multiple values but not in the schema as a list, only the first one is kept")
+		}
+		v = arr[0]
+	}
+	return e.convertOne(f, v)
+}
+
+func (e *parquetEncoder) convertOne(f *pqField, v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	switch f.kind {
+	case pqString:
+		return cellString(v), true
+	case pqObject:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			e.warn(f, "is not an object, set to null")
+			return nil, false
+		}
+		result := make(map[string]interface{}, len(f.fields))
+		for _, c := range f.fields {
+			if cv, ok := e.convert(c, m[c.name]); ok {
+				result[c.name] = cv
+			}
+		}
+		return result, true
+	case pqInt64:
+		if n, err := strconv.ParseInt(cellString(v), 10, 64); err == nil {
+			return n, true
+		}
+		if n, err := strconv.ParseFloat(cellString(v), 64); err == nil && n == math.Trunc(n) && math.Abs(n) < math.MaxInt64 {
+			return int64(n), true
+		}
+	case pqDouble:
+		if n, err := strconv.ParseFloat(cellString(v), 64); err == nil {
+			return n, true
+		}
+	case pqBool:
+		if b, err := strconv.ParseBool(cellString(v)); err == nil {
+			return b, true
+		}
+	}
+	e.warn(f, fmt.Sprintf("value %s can not be converted to %s, set to null", cellString(v), f.kind))
+	return nil, false
+}
+
+func flatten(arr []interface{}) []interface{} {
+	var result []interface{}
+	for _, v := range arr {
+		if sub, ok := v.([]interface{}); ok {
+			result = append(result, flatten(sub)...)
+		} else if v != nil {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// expandDots 将字段名中的 . 展开为对象，如 {"a.b":1} 展开为 {"a":{"b":1}}，同 es 的处理方式
+func expandDots(src map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		v = expandValue(v)
+		parts := strings.Split(k, ".")
+		cur := result
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := cur[p].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				cur[p] = next
+			}
+			cur = next
+		}
+		last := parts[len(parts)-1]
+		if old, ok := cur[last].(map[string]interface{}); ok {
+			if m, ok := v.(map[string]interface{}); ok {
+				for mk, mv := range m {
+					old[mk] = mv
+				}
+				continue
+			}
+		}
+		cur[last] = v
+	}
+	return result
+}
+
+func expandValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return expandDots(val)
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, ev := range val {
+			result[i] = expandValue(ev)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// bytesFile 只读的内存 parquet 文件
+type bytesFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newBytesFile(data []byte) *bytesFile {
+	return &bytesFile{Reader: bytes.NewReader(data), data: data}
+}
+
+func (f *bytesFile) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("bytesFile is read only")
+}
+
+func (f *bytesFile) Close() error {
+	return nil
+}
+
+// Open reader 按列读取时会打开多个文件，每次返回独立的读取位置
+func (f *bytesFile) Open(name string) (source.ParquetFile, error) {
+	return newBytesFile(f.data), nil
+}
+
+func (f *bytesFile) Create(name string) (source.ParquetFile, error) {
+	return nil, fmt.Errorf("bytesFile is read only")
+}
+
+func TestParquetEncoder(t *testing.T) {
+	docs := []string{
+		`{"_index":"test","_id":"1","_source":{"name":"a","age":10,"score":1.5,"ok":true,"tags":["x","y"],"user":{"id":1},"geo.city":"bj"}}`,
+		`{"_index":"test","_id":"2","_source":{"name":"b","age":"12","score":2,"tags":"z","user":{"id":2,"nick":"n"},"comments":[{"by":"u1"},{"by":"u2"}]}}`,
+		`{"_index":"test","_id":"3","_source":{"name":"c","age":"bad","ok":"false"}}`,
+	}
+	mapping := map[string]interface{}{
+		"name":     map[string]interface{}{"type": "keyword"},
+		"age":      map[string]interface{}{"type": "long"},
+		"score":    map[string]interface{}{"type": "float"},
+		"ok":       map[string]interface{}{"type": "boolean"},
+		"tags":     map[string]interface{}{"type": "keyword"},
+		"user":     map[string]interface{}{"properties": map[string]interface{}{"id": map[string]interface{}{"type": "integer"}}},
+		"comments": map[string]interface{}{"type": "nested", "properties": map[string]interface{}{"by": map[string]interface{}{"type": "keyword"}}},
+		"alias":    map[string]interface{}{"type": "alias", "path": "name"},
+	}
+	tests := []struct {
+		name       string
+		conf       ParquetOutputConfig
+		properties map[string]interface{}
+		want       []string
+	}{
+		{
+			name:       "mapping",
+			properties: mapping,
+			conf:       ParquetOutputConfig{Schema: SchemaMapping, SampleSize: 2},
+			want: []string{
+				`{"Age":10,"Comments":null,"Name":"a","Ok":true,"Score":1.5,"Tags":["x","y"],"User":{"Id":1},"_id":"1","_index":"test"}`,
+				`{"Age":12,"Comments":[{"By":"u1"},{"By":"u2"}],"Name":"b","Ok":null,"Score":2,"Tags":["z"],"User":{"Id":2},"_id":"2","_index":"test"}`,
+				`{"Age":null,"Comments":null,"Name":"c","Ok":false,"Score":null,"Tags":null,"User":null,"_id":"3","_index":"test"}`,
+			},
+		},
+		{
+			name: "sample",
+			conf: ParquetOutputConfig{Schema: SchemaSample, Compression: "zstd"},
+			want: []string{
+				`{"Age":"10","Comments":null,"Geo":{"City":"bj"},"Name":"a","Ok":"true","Score":1.5,"Tags":["x","y"],"User":{"Id":1,"Nick":null},"_id":"1","_index":"test"}`,
+				`{"Age":"12","Comments":[{"By":"u1"},{"By":"u2"}],"Geo":null,"Name":"b","Ok":null,"Score":2,"Tags":["z"],"User":{"Id":2,"Nick":"n"},"_id":"2","_index":"test"}`,
+				`{"Age":"bad","Comments":null,"Geo":null,"Name":"c","Ok":"false","Score":null,"Tags":null,"User":null,"_id":"3","_index":"test"}`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.conf
+			if err := c.init(); err != nil {
+				t.Fatal(err)
+			}
+			c.properties = tt.properties
+			enc := newParquetEncoder(&c)
+			var buf bytes.Buffer
+			if err := enc.Begin(&buf); err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range docs {
+				item, err := internal.NewDataItem(doc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err = enc.Encode(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := enc.End(); err != nil {
+				t.Fatal(err)
+			}
+
+			pr, err := reader.NewParquetReader(newBytesFile(buf.Bytes()), nil, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pr.ReadStop()
+			if int(pr.GetNumRows()) != len(docs) {
+				t.Fatalf("rows = %d, want %d", pr.GetNumRows(), len(docs))
+			}
+			rows, err := pr.ReadByNumber(len(docs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, row := range rows {
+				bf, _ := json.Marshal(row)
+				// 转为 map 后再序列化，使字段按名称排序，reader 中 _ 开头的字段名有前缀
+				var m map[string]interface{}
+				json.Unmarshal(bf, &m)
+				for k, v := range m {
+					if name := strings.TrimPrefix(k, "PARGO_PREFIX_"); name != k {
+						delete(m, k)
+						m[name] = v
+					}
+				}
+				bf, _ = json.Marshal(m)
+				if string(bf) != tt.want[i] {
+					t.Errorf("row %d = %s\nwant %s", i, bf, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+func TestEncoder(t *testing.T) {
+	const doc = `{"_index":"test","_type":"doc","_id":"1","_source":{"a":1}}`
+	tests := []struct {
+		name string
+		conf OutputConfig
+		want string
+	}{
+		{
+			name: "ndjson",
+			want: doc + "\n",
+		},
+		{
+			name: "bulk",
+			conf: OutputConfig{Format: FormatBulk},
+			want: `{"index":{"_index":"test","_type":"doc","_id":"1"}}` + "\n" + `{"a":1}` + "\n",
+		},
+		{
+			name: "bulk rename",
+			conf: OutputConfig{Format: FormatBulk, Bulk: &BulkOutputConfig{Index: "test_v2", Type: "_doc", OpType: "create"}},
+			want: `{"create":{"_index":"test_v2","_type":"_doc","_id":"1"}}` + "\n" + `{"a":1}` + "\n",
+		},
+		{
+			name: "bulk remove type",
+			conf: OutputConfig{Format: FormatBulk, Bulk: &BulkOutputConfig{RemoveType: true, OpType: "delete"}},
+			want: `{"delete":{"_index":"test","_id":"1"}}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.conf
+			if err := c.init(); err != nil {
+				t.Fatal(err)
+			}
+			enc, err := newEncoder(&c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			item, err := internal.NewDataItem(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := enc.Encode(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Encode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	invalid := &OutputConfig{Format: "xml"}
+	if err := invalid.init(); err == nil {
+		t.Error("invalid format should fail")
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	const doc = `{"_index":"test","_id":"1","_source":{"user":{"name":"a,b"},"tags":["x","y"],"n":1.5,
+"comments":[{"author":"u1","at":1},{"author":"u2"}],"geo.city":"bj","ok":true}}`
+	columns := []string{"_id", "_index", "user.name", "tags", "comments.author", "comments.at", "geo.city", "ok", "missing"}
+	tests := []struct {
+		name   string
+		format string
+		conf   CSVOutputConfig
+		header string
+		want   string
+	}{
+		{
+			name:   "json",
+			format: FormatCSV,
+			header: "_id,_index,user.name,tags,comments.author,comments.at,geo.city,ok,missing\n",
+			want:   `1,test,"a,b","[""x"",""y""]","[""u1"",""u2""]","[1,null]",bj,true,` + "\n",
+		},
+		{
+			name:   "join tsv",
+			format: FormatTSV,
+			conf:   CSVOutputConfig{Array: ArrayJoin, JoinSeparator: ";", NoHeader: true},
+			want:   "1\ttest\ta,b\tx;y\tu1;u2\t1;\tbj\ttrue\t\n",
+		},
+		{
+			name:   "explode",
+			format: FormatCSV,
+			conf:   CSVOutputConfig{Array: ArrayExplode, NoHeader: true},
+			want:   `1,test,"a,b",x,u1,1,bj,true,` + "\n" + `1,test,"a,b",y,u2,,bj,true,` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := tt.conf
+			cc.Columns = columns
+			c := OutputConfig{Format: tt.format, CSV: &cc}
+			if err := c.init(); err != nil {
+				t.Fatal(err)
+			}
+			enc, _ := newEncoder(&c)
+			if got := string(enc.(headerEncoder).Header()); got != tt.header {
+				t.Errorf("Header() = %q, want %q", got, tt.header)
+			}
+			item, err := internal.NewDataItem(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := enc.Encode(item)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if err := (&OutputConfig{Format: FormatCSV}).init(); err == nil {
+		t.Error("csv without columns should fail")
+	}
+}
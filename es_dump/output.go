@@ -0,0 +1,508 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// OutputConfig 输出的配置，未配置 path 时输出到 stdout
+type OutputConfig struct {
+	// Path 输出文件的路径模板，支持 {index}、{date}(开始的日期，如 20201018)、{part}(文件序号，如 00001)
+	Path string `json:"path"`
+
+	// MaxDocs 每个文件最多写入的条数，为 0 时不限制
+	MaxDocs int64 `json:"max_docs"`
+
+	// MaxBytes 每个文件最多写入的字节数(压缩前)，为 0 时不限制
+	MaxBytes int64 `json:"max_bytes"`
+
+	// Compress 压缩方式：none、gzip、zstd，为空时依据 path 的扩展名(.gz、.zst)判断
+	Compress string `json:"compress"`
+
+	// Manifest 清单文件，记录所有文件的条数、大小和 sha256，默认为第一个文件所在目录下的 manifest.json
+	Manifest string `json:"manifest"`
+
+	// Format 输出的格式：ndjson、bulk、csv、tsv、parquet，默认为 ndjson，可以使用 -format 参数修改
+	Format string `json:"format"`
+
+	// Bulk format 为 bulk 时的配置
+	Bulk *BulkOutputConfig `json:"bulk"`
+
+	// CSV format 为 csv、tsv 时的配置
+	CSV *CSVOutputConfig `json:"csv"`
+
+	// Parquet format 为 parquet 时的配置
+	Parquet *ParquetOutputConfig `json:"parquet"`
+}
+
+func (c *OutputConfig) init() error {
+	if c.Format == "" {
+		c.Format = FormatNDJSON
+	}
+	if c.Bulk == nil {
+		c.Bulk = &BulkOutputConfig{}
+	}
+	if err := c.Bulk.init(); err != nil {
+		return err
+	}
+	if c.Format == FormatCSV || c.Format == FormatTSV {
+		if c.CSV == nil {
+			return fmt.Errorf("output.csv is required when format is %s", c.Format)
+		}
+		if err := c.CSV.init(); err != nil {
+			return err
+		}
+	}
+	if c.Parquet == nil {
+		c.Parquet = &ParquetOutputConfig{}
+	}
+	if err := c.Parquet.init(); err != nil {
+		return err
+	}
+	if _, err := newEncoder(c); err != nil {
+		return err
+	}
+	var err error
+	if c.Compress, err = internal.CheckCompress(c.Compress, c.Path); err != nil {
+		return err
+	}
+	if c.Format == FormatParquet && c.Compress != internal.CompressNone {
+		return fmt.Errorf("output.compress can not be used with parquet, use output.parquet.compression")
+	}
+	if c.MaxDocs < 0 || c.MaxBytes < 0 {
+		return fmt.Errorf("output.max_docs and output.max_bytes should be >= 0")
+	}
+	if c.Path == "" {
+		if c.MaxDocs > 0 || c.MaxBytes > 0 || c.Manifest != "" {
+			return fmt.Errorf("output.max_docs, output.max_bytes and output.manifest require output.path")
+		}
+		return nil
+	}
+	if (c.MaxDocs > 0 || c.MaxBytes > 0) && !strings.Contains(c.Path, "{part}") {
+		return fmt.Errorf("output.path %q should contains {part} when output.max_docs or output.max_bytes is set", c.Path)
+	}
+	return nil
+}
+
+// Manifest 导出文件的清单
+type Manifest struct {
+	Index      string          `json:"index"`
+	Format     string          `json:"format"`
+	Compress   string          `json:"compress"`
+	StartTime  string          `json:"start_time"`
+	Date       string          `json:"date"`                  // path 中 {date} 的值，-resume 时继续使用
+	FinishTime string          `json:"finish_time,omitempty"` // 为空时导出未完成
+	Docs       int64           `json:"docs"`
+	Parts      []*ManifestPart `json:"parts"`
+}
+
+// ManifestPart 一个导出文件
+type ManifestPart struct {
+	Name   string `json:"name"` // 相对于清单文件所在目录的路径
+	Docs   int64  `json:"docs"`
+	Bytes  int64  `json:"bytes"` // 文件大小
+	SHA256 string `json:"sha256"`
+}
+
+func readManifest(fileName string) (*Manifest, error) {
+	bs, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var m *Manifest
+	if err = json.Unmarshal(bs, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest %s failed: %w", fileName, err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) save(fileName string) error {
+	bf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(bf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
+
+// part 一个输出文件：buf -> 压缩 -> 计数和 sha256 -> 文件
+type part struct {
+	name  string
+	file  *os.File // stdout 时为 nil
+	cw    internal.CompressWriter
+	buf   *bufio.Writer
+	hash  hash.Hash
+	size  int64 // 写入文件的字节数
+	docs  int64
+	bytes int64 // 压缩前的字节数
+}
+
+func newPart(name string, w io.Writer, file *os.File, compress string) (*part, error) {
+	p := &part{
+		name: name,
+		file: file,
+		hash: sha256.New(),
+	}
+	var err error
+	if p.cw, err = internal.NewCompressWriter(p.countWriter(w), compress); err != nil {
+		return nil, err
+	}
+	p.buf = bufio.NewWriterSize(p.cw, 256*1024)
+	return p, nil
+}
+
+func (p *part) countWriter(w io.Writer) io.Writer {
+	return writerFunc(func(b []byte) (int, error) {
+		n, err := w.Write(b)
+		p.hash.Write(b[:n])
+		p.size += int64(n)
+		return n, err
+	})
+}
+
+func (p *part) flush() error {
+	if err := p.buf.Flush(); err != nil {
+		return err
+	}
+	return p.cw.Flush()
+}
+
+func (p *part) close() error {
+	if err := p.buf.Flush(); err != nil {
+		return err
+	}
+	if err := p.cw.Close(); err != nil {
+		return err
+	}
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
+
+type writerFunc func(b []byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
+// output 将数据写入 stdout，或者按 max_docs、max_bytes 切分写入多个文件，
+// 每个文件完成后更新清单文件
+type output struct {
+	conf     *OutputConfig
+	index    string
+	date     string // {date} 的值
+	manifest *Manifest
+	mfName   string // 清单文件名，输出到 stdout 时为空
+	cur      *part
+	enc      encoder
+
+	// acks 已写入当前文件的数据的确认函数，文件记录到清单后才调用
+	acks []func()
+
+	// afterAcks 文件记录到清单并确认数据后调用，可以为 nil
+	afterAcks func()
+}
+
+// dateGlob 匹配 {date} 的值
+const dateGlob = "[0-9][0-9][0-9][0-9][0-9][0-9][0-9][0-9]"
+
+// newOutput 创建 output，resume 时从清单文件中最后一个文件之后继续，
+// 并使用清单中记录的 {date}
+func newOutput(c *OutputConfig, index string, resume bool) (*output, error) {
+	start := time.Now()
+	o := &output{
+		conf:  c,
+		index: index,
+		date:  start.Format("20060102"),
+	}
+	var err error
+	if o.enc, err = newEncoder(c); err != nil {
+		return nil, err
+	}
+	o.manifest = &Manifest{
+		Index:     index,
+		Format:    c.Format,
+		Compress:  c.Compress,
+		StartTime: start.Format("2006-01-02 15:04:05"),
+		Date:      o.date,
+		Parts:     []*ManifestPart{},
+	}
+	if c.Path == "" {
+		if o.cur, err = newPart("", os.Stdout, nil, c.Compress); err != nil {
+			return nil, err
+		}
+		return o, o.begin()
+	}
+	o.mfName = o.manifestName()
+	if !resume {
+		return o, nil
+	}
+	m, err := o.findManifest()
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Format == "" {
+		m.Format = FormatNDJSON
+	}
+	if m.Index != index || m.Format != c.Format || m.Compress != c.Compress {
+		return nil, fmt.Errorf("manifest %s is not match the config, index=%q format=%q compress=%q", o.mfName, m.Index, m.Format, m.Compress)
+	}
+	if m.Date == "" {
+		// 没有记录 date 的清单，使用开始的日期
+		st, err := time.ParseInLocation("2006-01-02 15:04:05", m.StartTime, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s has no date and invalid start_time %q", o.mfName, m.StartTime)
+		}
+		m.Date = st.Format("20060102")
+	}
+	m.FinishTime = ""
+	o.manifest = m
+	o.date = m.Date
+	if name := o.partName(len(m.Parts)); fileExists(name) {
+		// 数据只有在文件记录到清单后才确认，该文件中的数据都在断点之后，重新写入
+		log.Println("output file", name, "is not in the manifest, overwrite it")
+	}
+	return o, nil
+}
+
+// manifestName 清单文件名
+func (o *output) manifestName() string {
+	if o.conf.Manifest != "" {
+		return o.conf.Manifest
+	}
+	return filepath.Join(filepath.Dir(o.partName(0)), "manifest.json")
+}
+
+// findManifest 读取 resume 时的清单文件。
+// 清单文件所在的目录包含 {date} 时，使用日期最大的清单文件
+func (o *output) findManifest() (*Manifest, error) {
+	if o.conf.Manifest != "" || !strings.Contains(filepath.Dir(o.conf.Path), "{date}") {
+		return readManifest(o.mfName)
+	}
+	date := o.date
+	o.date = dateGlob
+	pattern := o.manifestName()
+	o.date = date
+	names, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return readManifest(o.mfName)
+	}
+	sort.Strings(names)
+	o.mfName = names[len(names)-1]
+	return readManifest(o.mfName)
+}
+
+// partName 第 n 个文件的文件名
+func (o *output) partName(n int) string {
+	r := strings.NewReplacer(
+		"{index}", o.index,
+		"{date}", o.date,
+		"{part}", fmt.Sprintf("%05d", n),
+	)
+	return r.Replace(o.conf.Path)
+}
+
+func (o *output) open() error {
+	name := o.partName(len(o.manifest.Parts))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	o.cur, err = newPart(name, f, f, o.conf.Compress)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	log.Println("open output file:", name)
+	return o.begin()
+}
+
+// begin 文件开始时写入表头(表头不计入条数)，或者通知 fileEncoder
+func (o *output) begin() error {
+	switch enc := o.enc.(type) {
+	case fileEncoder:
+		return enc.Begin(o.cur.buf)
+	case headerEncoder:
+		header := enc.Header()
+		o.cur.bytes += int64(len(header))
+		_, err := o.cur.buf.Write(header)
+		return err
+	}
+	return nil
+}
+
+// end 文件结束时通知 fileEncoder
+func (o *output) end() error {
+	if enc, ok := o.enc.(fileEncoder); ok {
+		return enc.End()
+	}
+	return nil
+}
+
+// finishPart 关闭当前的文件，并记录到清单文件中
+func (o *output) finishPart() error {
+	p := o.cur
+	o.cur = nil
+	if err := o.end(); err != nil {
+		return err
+	}
+	if err := p.close(); err != nil {
+		return err
+	}
+	name, err := filepath.Rel(filepath.Dir(o.mfName), p.name)
+	if err != nil {
+		name = p.name
+	}
+	o.manifest.Parts = append(o.manifest.Parts, &ManifestPart{
+		Name:   filepath.ToSlash(name),
+		Docs:   p.docs,
+		Bytes:  p.size,
+		SHA256: hex.EncodeToString(p.hash.Sum(nil)),
+	})
+	o.manifest.Docs += p.docs
+	if err = o.manifest.save(o.mfName); err != nil {
+		return err
+	}
+	if len(o.acks) > 0 {
+		o.runAcks()
+		if o.afterAcks != nil {
+			o.afterAcks()
+		}
+	}
+	return nil
+}
+
+// Ack 确认已写入的数据：写入文件时在当前文件记录到清单后调用 fn，
+// 输出到 stdout 时 flush 后立即调用
+func (o *output) Ack(fn func()) error {
+	if o.mfName == "" {
+		if err := o.cur.flush(); err != nil {
+			return err
+		}
+		fn()
+		return nil
+	}
+	o.acks = append(o.acks, fn)
+	if o.cur == nil {
+		// 数据已全部记录到清单中
+		o.runAcks()
+	}
+	return nil
+}
+
+func (o *output) runAcks() {
+	for _, fn := range o.acks {
+		fn()
+	}
+	o.acks = nil
+}
+
+// Write 按 format 编码后写入一条数据
+func (o *output) Write(item *internal.DataItem) error {
+	if o.cur == nil {
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+	data, err := o.enc.Encode(item)
+	if err != nil {
+		return err
+	}
+	if _, ok := o.enc.(fileEncoder); ok {
+		// 已经由 encoder 写入
+		return o.count(int64(len(data)))
+	}
+	return o.WriteDoc(data)
+}
+
+// WriteDoc 写入一条已编码的数据，data 需要包含结尾的换行符
+func (o *output) WriteDoc(data []byte) error {
+	if o.cur == nil {
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+	if _, err := o.cur.buf.Write(data); err != nil {
+		return err
+	}
+	return o.count(int64(len(data)))
+}
+
+// count 记录写入了一条 size 字节的数据，达到 max_docs 或 max_bytes 时结束当前文件
+func (o *output) count(size int64) error {
+	o.cur.docs++
+	o.cur.bytes += size
+	if o.mfName == "" {
+		return nil
+	}
+	if (o.conf.MaxDocs > 0 && o.cur.docs >= o.conf.MaxDocs) || (o.conf.MaxBytes > 0 && o.cur.bytes >= o.conf.MaxBytes) {
+		return o.finishPart()
+	}
+	return nil
+}
+
+// Close 关闭当前的文件，完成时(finished 为 true)在清单文件中记录完成时间
+func (o *output) Close(finished bool) error {
+	if o.mfName == "" {
+		if err := o.end(); err != nil {
+			return err
+		}
+		return o.cur.close()
+	}
+	if o.cur != nil {
+		if err := o.finishPart(); err != nil {
+			return err
+		}
+	}
+	if finished {
+		o.manifest.FinishTime = time.Now().Format("2006-01-02 15:04:05")
+	}
+	return o.manifest.save(o.mfName)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
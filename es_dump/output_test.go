@@ -0,0 +1,219 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     OutputConfig
+		docs     int
+		wantDocs []int64
+	}{
+		{
+			name:     "max docs",
+			conf:     OutputConfig{Path: "{index}-{part}.json", MaxDocs: 4},
+			docs:     10,
+			wantDocs: []int64{4, 4, 2},
+		},
+		{
+			name:     "max bytes gzip",
+			conf:     OutputConfig{Path: "{index}/{part}.json.gz", MaxBytes: 30},
+			docs:     5,
+			wantDocs: []int64{3, 2},
+		},
+		{
+			name:     "single zstd",
+			conf:     OutputConfig{Path: "{index}.json", Compress: "zstd"},
+			docs:     5,
+			wantDocs: []int64{5},
+		},
+		{
+			name: "empty",
+			conf: OutputConfig{Path: "{index}.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "es_dump")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			c := tt.conf
+			c.Path = filepath.Join(dir, c.Path)
+			if err = c.init(); err != nil {
+				t.Fatal(err)
+			}
+			out, err := newOutput(&c, "test", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.docs; i++ {
+				// 每条 12 字节
+				if err = out.WriteDoc([]byte(fmt.Sprintf("{\"_id\":%02d}\n", i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err = out.Close(true); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := readManifest(out.mfName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.FinishTime == "" || m.Docs != int64(tt.docs) || len(m.Parts) != len(tt.wantDocs) {
+				t.Fatalf("unexpected manifest: %+v", m)
+			}
+			for i, p := range m.Parts {
+				if p.Docs != tt.wantDocs[i] {
+					t.Errorf("part %d docs = %d, want %d", i, p.Docs, tt.wantDocs[i])
+				}
+				bs, err := ioutil.ReadFile(filepath.Join(filepath.Dir(out.mfName), p.Name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				sum := sha256.Sum256(bs)
+				if int64(len(bs)) != p.Bytes || hex.EncodeToString(sum[:]) != p.SHA256 {
+					t.Errorf("part %d bytes or sha256 not match", i)
+				}
+			}
+		})
+	}
+}
+
+func TestOutputConfig_init(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    OutputConfig
+		wantErr bool
+	}{
+		{name: "stdout", conf: OutputConfig{}},
+		{name: "stdout gzip", conf: OutputConfig{Compress: "gzip"}},
+		{name: "stdout rotate", conf: OutputConfig{MaxDocs: 10}, wantErr: true},
+		{name: "rotate without part", conf: OutputConfig{Path: "a.json", MaxBytes: 10}, wantErr: true},
+		{name: "invalid compress", conf: OutputConfig{Path: "a.json", Compress: "xz"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.conf.init(); (err != nil) != tt.wantErr {
+				t.Errorf("init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutput_Ack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es_dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := OutputConfig{Path: filepath.Join(dir, "{part}.json"), MaxDocs: 3}
+	if err = c.init(); err != nil {
+		t.Fatal(err)
+	}
+	out, err := newOutput(&c, "test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var acked []int
+	// 每页 2 条，每个文件 3 条：第 2 页跨越两个文件，第 3 页写完时文件刚好结束
+	wantAcked := []int{0, 1, 3, 3}
+	for page := 0; page < 4; page++ {
+		for i := 0; i < 2; i++ {
+			if err = out.WriteDoc([]byte(fmt.Sprintf("{\"_id\":%d}\n", page*2+i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		page := page
+		if err = out.Ack(func() { acked = append(acked, page) }); err != nil {
+			t.Fatal(err)
+		}
+		if len(acked) != wantAcked[page] {
+			t.Errorf("page %d: acked = %v, want %d pages", page, acked, wantAcked[page])
+		}
+	}
+	if err = out.Close(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(acked) != 4 {
+		t.Errorf("acked after Close() = %v", acked)
+	}
+}
+
+func TestOutput_resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es_dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := OutputConfig{Path: filepath.Join(dir, "{date}", "{index}-{part}.json"), MaxDocs: 2}
+	if err = c.init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 前一天的导出，第 2 个文件未完成
+	oldDir := filepath.Join(dir, "20201018")
+	if err = os.MkdirAll(oldDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m := &Manifest{
+		Index:     "test",
+		Format:    FormatNDJSON,
+		Compress:  "none",
+		StartTime: "2020-10-18 23:59:00",
+		Docs:      2,
+		Parts:     []*ManifestPart{{Name: "test-00000.json", Docs: 2}},
+	}
+	if err = m.save(filepath.Join(oldDir, "manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+	partial := filepath.Join(oldDir, "test-00001.json")
+	if err = ioutil.WriteFile(partial, []byte("{\"_id\":"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := newOutput(&c, "test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(oldDir, "manifest.json"); out.mfName != want {
+		t.Errorf("mfName = %q, want %q", out.mfName, want)
+	}
+	if err = out.WriteDoc([]byte("{\"_id\":2}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err = out.Close(true); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := ioutil.ReadFile(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(bs) != "{\"_id\":2}\n" {
+		t.Errorf("partial file = %q", bs)
+	}
+	m, err = readManifest(out.mfName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Date != "20201018" || m.Docs != 3 || len(m.Parts) != 2 || m.Parts[1].Name != "test-00001.json" {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+}
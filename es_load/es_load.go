@@ -0,0 +1,316 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hidu/goutils/time_util"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// IndexInfo 写入的索引信息
+type IndexInfo struct {
+	Host    *internal.Host    `json:"host"`
+	DocType *internal.DocType `json:"type"`
+}
+
+// Config 配置信息
+type Config struct {
+	// NewIndex 写入的集群，type.index、type.type 不为空时替换数据中的 _index、_type
+	NewIndex *IndexInfo `json:"new_index"`
+
+	internal.WriteConfig
+}
+
+// String 序列化
+func (c *Config) String() string {
+	bf, _ := json.Marshal(c)
+	return string(bf)
+}
+
+// CounterType 计数器
+type CounterType struct {
+	*internal.WriteCounter
+	files      int    // 输入的文件数
+	fileNo     int32  // 正在读取的文件序号，从 1 开始
+	totalBytes uint64 // 输入文件的总大小，读取 stdin 时为 0
+	readBytes  uint64 // 已读取的字节数(解压前)
+}
+
+func (c *CounterType) String() string {
+	return fmt.Sprintf("counter[file=%d/%d bytes=%d/%d read=%d %s]",
+		atomic.LoadInt32(&c.fileNo), c.files, atomic.LoadUint64(&c.readBytes), c.totalBytes, c.Read(), c.Summary())
+}
+
+// Progress 按读取的字节数计算的完成百分比和预计剩余的秒数，总大小未知时 need 为 -1
+func (c *CounterType) Progress() (finishRate float64, need float64) {
+	read := atomic.LoadUint64(&c.readBytes)
+	need = -1
+	if c.totalBytes == 0 {
+		return 0, need
+	}
+	finishRate = float64(read) / float64(c.totalBytes)
+	if used := c.Elapsed().Seconds(); used > 0 && read > 0 && c.totalBytes >= read {
+		need = float64(c.totalBytes-read) / (float64(read) / used)
+	}
+	return finishRate, need
+}
+
+// PrintLog 打印输出，会依据处理梳理，估算出大致完成的时间
+func (c *CounterType) PrintLog() {
+	finishRate, need := c.Progress()
+	internal.LogProgress(c, finishRate, need)
+}
+
+// countReader 统计已读取的字节数
+type countReader struct {
+	r io.Reader
+	n *uint64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddUint64(c.n, uint64(n))
+	return n, err
+}
+
+// pageSize 每次交给 bulk_worker 处理的条数
+const pageSize = 100
+
+var conf = flag.String("conf", "es_load.json", "load config file name")
+var bulkWorker = flag.Int("bulk_worker", 3, "bulk worker num")
+var isDebug = flag.Bool("debug", false, "debug and print")
+var replayFile = flag.String("replay", "", "replay the dead letter file, write the failed items again")
+
+// batcher 所有 bulk_worker 共用，将数据重新分组后发送 bulk 请求
+var batcher *internal.BulkBatcher
+
+// deadLetter bulk 失败的数据写入文件，未配置 dead_letter_file 时为 nil
+var deadLetter *internal.DeadLetterWriter
+
+var counter = &CounterType{
+	WriteCounter: internal.NewWriteCounter(),
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file ...]\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "read from stdin when no file or the file is -")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// readConf 会切换工作目录，所以先转换为绝对路径
+	inputs := flag.Args()
+	if *replayFile != "" {
+		if len(inputs) > 0 {
+			fmt.Println("-replay can not be used with input files")
+			os.Exit(2)
+		}
+		*replayFile, _ = filepath.Abs(*replayFile)
+		inputs = []string{*replayFile}
+	}
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	for i, name := range inputs {
+		if name != "-" {
+			inputs[i], _ = filepath.Abs(name)
+		}
+	}
+	*conf, _ = filepath.Abs(*conf)
+
+	config, err := readConf(*conf)
+	if err != nil {
+		fmt.Println("parser config failed:", err)
+		os.Exit(2)
+	}
+	for _, name := range inputs {
+		if name == config.DeadLetterFile {
+			fmt.Println("dead_letter_file can not be the same as the input file")
+			os.Exit(2)
+		}
+	}
+	internal.HandleReload(*conf, config.Throttler())
+
+	load(config, inputs)
+}
+
+func readConf(confName string) (*Config, error) {
+	bs, err := ioutil.ReadFile(confName)
+	if err != nil {
+		return nil, err
+	}
+
+	os.Chdir(path.Dir(confName))
+
+	var conf *Config
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	err = dec.Decode(&conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.NewIndex == nil || conf.NewIndex.Host == nil {
+		return nil, fmt.Errorf("new_index.host is empty")
+	}
+	err = conf.NewIndex.Host.Init()
+	checkErr("parse new index", err)
+
+	if conf.NewIndex.DocType == nil {
+		conf.NewIndex.DocType = &internal.DocType{}
+	}
+
+	conf.Debug = *isDebug
+	if err = conf.WriteConfig.Init(conf.NewIndex.Host, conf.NewIndex.DocType, *replayFile); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func checkErr(msg string, err error) {
+	if err != nil {
+		log.Fatalln(msg, err, counter.String())
+	}
+}
+
+func load(conf *Config, inputs []string) {
+	log.Println("[info] start load, files=", inputs)
+
+	counter.files = len(inputs)
+	for _, name := range inputs {
+		if name == "-" {
+			counter.totalBytes = 0
+			break
+		}
+		info, err := os.Stat(name)
+		checkErr("stat input file failed", err)
+		counter.totalBytes += uint64(info.Size())
+	}
+
+	writer, err := conf.NewBulkWriter(counter)
+	checkErr("open dead_letter_file failed", err)
+	deadLetter = writer.DeadLetter
+	defer deadLetter.Close()
+	batcher = conf.Bulk.NewBatcher(writer.Write)
+
+	stop := make(chan struct{})
+	internal.HandleSignal(func() {
+		close(stop)
+	}, func() {
+		deadLetter.Close()
+	}, counter.String)
+
+	jobs := make(chan *internal.ScrollResponse, *bulkWorker*5)
+	var wg sync.WaitGroup
+	for i := 0; i < *bulkWorker; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			var fixer *internal.SubProcess
+			if conf.DataFixCmd != "" {
+				var err error
+				fixer, err = internal.NewSubProcess(conf.DataFixCmd, strconv.Itoa(id))
+				checkErr("start data_fix_cmd failed", err)
+				defer fixer.Close()
+			}
+			for job := range jobs {
+				loadPage(conf, job, fixer)
+			}
+		}(i)
+	}
+
+	time_util.SetInterval(counter.PrintLog, 5)
+
+	log.Println("[info] started bulk worker,n=", *bulkWorker)
+
+	parse := internal.NewDataItem
+	if *replayFile != "" {
+		log.Println("[info] replay dead letter file:", *replayFile)
+		parse = internal.NewDataItemFromDeadLetter
+	}
+	readFn := func(sr *internal.ScrollResponse) bool {
+		counter.AddRead(len(sr.Hits.Hits))
+		jobs <- sr
+		return !internal.IsStopped(stop)
+	}
+	for i, name := range inputs {
+		atomic.StoreInt32(&counter.fileNo, int32(i+1))
+		log.Println("[info] read file:", name)
+		finished, err := readFile(name, parse, readFn)
+		checkErr("read "+name+" failed", err)
+		if !finished {
+			break
+		}
+	}
+
+	interrupted := internal.IsStopped(stop)
+	if interrupted {
+		log.Println("[info] read stopped, wait bulk workers")
+	} else {
+		log.Println("[info] no more message")
+	}
+
+	close(jobs)
+	wg.Wait()
+	batcher.Close()
+
+	if interrupted {
+		log.Println("[info] bulkWorker all finished, interrupted load", counter.String())
+		deadLetter.Close()
+		os.Exit(internal.ExitInterrupted)
+	}
+
+	log.Println("[info] bulkWorker all finished, stop load", counter.String())
+}
+
+// readFile 读取一个文件，name 为 - 时读取 stdin，gzip、zstd 压缩的文件自动解压，
+// fn 返回 false 时停止读取并返回 false
+func readFile(name string, parse func(line string) (*internal.DataItem, error), fn func(sr *internal.ScrollResponse) bool) (bool, error) {
+	var f io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return false, err
+		}
+		defer file.Close()
+		f = file
+	}
+	r, err := internal.NewDecompressReader(&countReader{r: f, n: &counter.readBytes})
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return internal.ReadPages(r, pageSize, parse, fn)
+}
+
+// loadPage 处理一页数据后交给 batcher 发送，数据中的 _seq_no、_primary_term 不写入
+func loadPage(conf *Config, page *internal.ScrollResponse, fixer *internal.SubProcess) {
+	lines := make([]string, 0, len(page.Hits.Hits))
+	for _, item := range page.Hits.Hits {
+		if line, _ := conf.BulkLine(item, fixer, false); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	counter.AddWrite(len(lines), len(page.Hits.Hits)-len(lines))
+	batcher.Add(lines, nil)
+}
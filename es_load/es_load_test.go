@@ -0,0 +1,72 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es_load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "data.json.gz")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	for i := 0; i < 250; i++ {
+		fmt.Fprintf(gw, `{"_index":"test","_id":"%d","_source":{"n":%d}}`+"\n", i, i)
+	}
+	gw.Close()
+	f.Close()
+	info, _ := os.Stat(name)
+
+	tests := []struct {
+		name         string
+		stopAt       int // 读取到第几页时停止，0 为不停止
+		wantFinished bool
+		wantPages    []int
+	}{
+		{name: "all", wantFinished: true, wantPages: []int{100, 100, 50}},
+		{name: "stop", stopAt: 2, wantPages: []int{100, 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreUint64(&counter.readBytes, 0)
+			var pages []int
+			finished, err := readFile(name, internal.NewDataItem, func(sr *internal.ScrollResponse) bool {
+				pages = append(pages, len(sr.Hits.Hits))
+				return len(pages) != tt.stopAt
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if finished != tt.wantFinished {
+				t.Errorf("finished = %v, want %v", finished, tt.wantFinished)
+			}
+			if fmt.Sprint(pages) != fmt.Sprint(tt.wantPages) {
+				t.Errorf("pages = %v, want %v", pages, tt.wantPages)
+			}
+			if tt.wantFinished && atomic.LoadUint64(&counter.readBytes) != uint64(info.Size()) {
+				t.Errorf("readBytes = %d, want %d", counter.readBytes, info.Size())
+			}
+		})
+	}
+}
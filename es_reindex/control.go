@@ -0,0 +1,438 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// bulk_worker 的状态
+const (
+	workerIdle     = "idle"
+	workerBusy     = "busy"
+	workerStopping = "stopping"
+)
+
+// worker 一个 bulk_worker，每个 worker 有独立的 data_fix_cmd 进程
+type worker struct {
+	id    int
+	state atomic.Value
+	pages uint64
+	quit  chan struct{}
+}
+
+// WorkerState worker 的状态，用于 /status 输出
+type WorkerState struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+	Pages uint64 `json:"pages"` // 已处理的页数
+}
+
+// workerPool 处理数据的 bulk_worker，可以在运行中调整数量
+type workerPool struct {
+	jobs   chan *internal.ScrollResponse
+	handle func(job *internal.ScrollResponse, fixer *internal.SubProcess)
+	newFix func(id int) (*internal.SubProcess, error)
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	closed  bool
+	nextID  int
+	workers map[int]*worker // 包括正在退出的 worker，run 返回后才删除
+}
+
+func newWorkerPool(jobs chan *internal.ScrollResponse, newFix func(id int) (*internal.SubProcess, error),
+	handle func(job *internal.ScrollResponse, fixer *internal.SubProcess)) *workerPool {
+	return &workerPool{
+		jobs:    jobs,
+		handle:  handle,
+		newFix:  newFix,
+		workers: make(map[int]*worker),
+	}
+}
+
+// Resize 调整 worker 数量，减少时 worker 处理完当前的数据后退出。
+// Close 之后不能再调整
+func (p *workerPool) Resize(n int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return fmt.Errorf("no more data to read, can not resize bulk_worker")
+	}
+	running := p.running()
+	for len(running) < n {
+		w := &worker{
+			id:   p.nextID,
+			quit: make(chan struct{}),
+		}
+		w.state.Store(workerIdle)
+		p.nextID++
+		p.workers[w.id] = w
+		running = append(running, w.id)
+		p.wg.Add(1)
+		go p.run(w)
+	}
+	for _, id := range running[n:] {
+		w := p.workers[id]
+		w.state.Store(workerStopping)
+		close(w.quit)
+	}
+	return nil
+}
+
+// running 没有在退出的 worker id，从小到大排列，需要持有锁
+func (p *workerPool) running() []int {
+	ids := p.ids()
+	sort.Ints(ids)
+	running := ids[:0]
+	for _, id := range ids {
+		if p.workers[id].state.Load() != workerStopping {
+			running = append(running, id)
+		}
+	}
+	return running
+}
+
+// ids 从大到小排列的 worker id，需要持有锁
+func (p *workerPool) ids() []int {
+	ids := make([]int, 0, len(p.workers))
+	for id := range p.workers {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	return ids
+}
+
+func (p *workerPool) run(w *worker) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.workers, w.id)
+		p.mu.Unlock()
+		p.wg.Done()
+	}()
+	log.Printf("[info] bulk_worker_start id=[%d]\n", w.id)
+	fixer, err := p.newFix(w.id)
+	checkErr("create SubProcess failed", err)
+	defer func() {
+		if fixer != nil {
+			fixer.Close()
+		}
+		log.Printf("[info] bulk_worker_finish id=[%d]", w.id)
+	}()
+	for {
+		select {
+		case <-w.quit:
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			p.setState(w, workerBusy)
+			p.handle(job, fixer)
+			atomic.AddUint64(&w.pages, 1)
+			select {
+			case <-w.quit:
+				return
+			default:
+				p.setState(w, workerIdle)
+			}
+		}
+	}
+}
+
+// setState 修改 worker 的状态，已经在退出的 worker 保持 stopping
+func (p *workerPool) setState(w *worker, state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w.state.Load() != workerStopping {
+		w.state.Store(state)
+	}
+}
+
+// Size 当前的 worker 数量，不包括正在退出的
+func (p *workerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.running())
+}
+
+// States 所有 worker 的状态
+func (p *workerPool) States() []WorkerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := p.ids()
+	sort.Ints(ids)
+	states := make([]WorkerState, 0, len(ids))
+	for _, id := range ids {
+		w := p.workers[id]
+		states = append(states, WorkerState{
+			ID:    w.id,
+			State: w.state.Load().(string),
+			Pages: atomic.LoadUint64(&w.pages),
+		})
+	}
+	return states
+}
+
+// Close 数据已全部读取，关闭 jobs，worker 处理完剩余的数据后退出
+func (p *workerPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+}
+
+// Wait 等待所有 worker 退出，需要先调用 Close
+func (p *workerPool) Wait() {
+	p.wg.Wait()
+}
+
+// controller 运行中的控制：暂停、恢复读取，修改限速、bulk_worker 数量，停止
+type controller struct {
+	conf *Config
+	pool *workerPool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}
+}
+
+func newController(conf *Config) *controller {
+	return &controller{
+		conf: conf,
+		stop: make(chan struct{}),
+	}
+}
+
+// Stop 停止读取，已读取的数据处理完成后退出，第一次调用时返回 true
+func (c *controller) Stop() bool {
+	first := false
+	c.stopOnce.Do(func() {
+		first = true
+		close(c.stop)
+	})
+	return first
+}
+
+// Pause 暂停读取，暂停的时间需要小于 scan_time，否则 scroll 会过期
+func (c *controller) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		c.paused = true
+		c.resume = make(chan struct{})
+		log.Println("[info] pause scroll", counter.String())
+	}
+}
+
+// Resume 恢复读取
+func (c *controller) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		c.paused = false
+		close(c.resume)
+		log.Println("[info] resume scroll", counter.String())
+	}
+}
+
+// Paused 是否已暂停
+func (c *controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// WaitResume 暂停时等待恢复或者停止
+func (c *controller) WaitResume() {
+	c.mu.Lock()
+	paused, resume := c.paused, c.resume
+	c.mu.Unlock()
+	if !paused {
+		return
+	}
+	select {
+	case <-resume:
+	case <-c.stop:
+	}
+}
+
+// Status /status 接口输出的进度信息
+type Status struct {
+	Counters   map[string]uint64  `json:"counters"`
+	Total      uint64             `json:"total"`
+	Progress   float64            `json:"progress"` // 已读取的百分比
+	Elapsed    float64            `json:"elapsed"`  // 已运行的秒数
+	ReadRate   float64            `json:"read_per_sec"`
+	WriteRate  float64            `json:"write_per_sec"` // bulk 已返回的条数计算
+	ETA        float64            `json:"eta"`           // 预计剩余的秒数，未知时为 -1
+	FinishTime string             `json:"finish_time,omitempty"`
+	Paused     bool               `json:"paused"`
+	Stopping   bool               `json:"stopping"`
+	BulkWorker int                `json:"bulk_worker"`
+	Workers    []WorkerState      `json:"workers"`
+	Throttle   map[string]float64 `json:"throttle"`
+}
+
+// Status 当前的进度
+func (c *controller) Status() *Status {
+	st := &Status{
+		Counters:   counter.Values(),
+		Total:      atomic.LoadUint64(&counter.total),
+		Paused:     c.Paused(),
+		Stopping:   internal.IsStopped(c.stop),
+		BulkWorker: c.pool.Size(),
+		Workers:    c.pool.States(),
+	}
+	st.Elapsed = counter.Elapsed().Seconds()
+	var finishRate float64
+	finishRate, st.ReadRate, st.ETA = counter.Progress()
+	st.Progress = 100 * finishRate
+	if st.Elapsed > 0 {
+		st.WriteRate = float64(st.Counters["bulk_c"]) / st.Elapsed
+	}
+	if st.ETA >= 0 {
+		st.FinishTime = time.Now().Add(time.Duration(st.ETA) * time.Second).Format("2006-01-02 15:04:05")
+	}
+	docs, bytes := c.conf.Throttler().Rates()
+	st.Throttle = map[string]float64{
+		"docs_per_sec":  docs,
+		"bytes_per_sec": bytes,
+	}
+	return st
+}
+
+// Serve 在 addr 上启动 http 服务：
+// GET /status 进度；POST /pause、/resume 暂停、恢复读取；POST /stop 停止；
+// POST /throttle?docs_per_sec=&bytes_per_sec= 修改限速；POST /workers?n= 修改 bulk_worker 数量。
+// 接口没有认证，allowPublic 为 false 时只允许监听本机地址
+func (c *controller) Serve(addr string, allowPublic bool) error {
+	if !allowPublic {
+		if err := checkLoopback(addr); err != nil {
+			return err
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("[info] control http server listen at:", ln.Addr())
+	go func() {
+		err := http.Serve(ln, c.handler())
+		log.Println("[err] control http server exit:", err)
+	}()
+	return nil
+}
+
+// checkLoopback 检查 addr 是否只监听本机地址，addr 中的主机名解析后需全部为本机地址
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if host != "" {
+		if ips, err = net.LookupIP(host); err != nil {
+			return err
+		}
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("http address %q listens on all interfaces, use a loopback address such as 127.0.0.1 or add -http_public", addr)
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return fmt.Errorf("http address %q is not a loopback address, the control api has no authentication, add -http_public to allow it", addr)
+		}
+	}
+	return nil
+}
+
+func (c *controller) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+	mux.HandleFunc("/pause", c.action(func(r *http.Request) error {
+		c.Pause()
+		return nil
+	}))
+	mux.HandleFunc("/resume", c.action(func(r *http.Request) error {
+		c.Resume()
+		return nil
+	}))
+	mux.HandleFunc("/stop", c.action(func(r *http.Request) error {
+		if c.Stop() {
+			log.Println("[info] receive stop request, stop scroll and wait bulk workers", counter.String())
+		}
+		return nil
+	}))
+	mux.HandleFunc("/throttle", c.action(func(r *http.Request) error {
+		docs, bytes := c.conf.Throttler().Rates()
+		var err error
+		if v := r.FormValue("docs_per_sec"); v != "" {
+			if docs, err = strconv.ParseFloat(v, 64); err != nil || docs < 0 {
+				return fmt.Errorf("invalid docs_per_sec %q", v)
+			}
+		}
+		if v := r.FormValue("bytes_per_sec"); v != "" {
+			if bytes, err = strconv.ParseFloat(v, 64); err != nil || bytes < 0 {
+				return fmt.Errorf("invalid bytes_per_sec %q", v)
+			}
+		}
+		c.conf.Throttler().SetRate(docs, bytes)
+		return nil
+	}))
+	mux.HandleFunc("/workers", c.action(func(r *http.Request) error {
+		n, err := strconv.Atoi(r.FormValue("n"))
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid n %q, should be >= 1", r.FormValue("n"))
+		}
+		log.Printf("[info] resize bulk_worker from %d to %d\n", c.pool.Size(), n)
+		return c.pool.Resize(n)
+	}))
+	return mux
+}
+
+// action 只允许 POST 请求，执行成功后返回当前的状态
+func (c *controller) action(fn func(r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed, use POST"})
+			return
+		}
+		if err := fn(r); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, c.Status())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	bf, _ := json.MarshalIndent(v, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bf)
+}
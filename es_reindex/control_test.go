@@ -0,0 +1,250 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+func TestController_handler(t *testing.T) {
+	conf := &Config{}
+	host := &internal.Host{Vs: &internal.ResponseVersion{VersionData: map[string]interface{}{"number": "7.10.0"}}}
+	if err := conf.WriteConfig.Init(host, &internal.DocType{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	ctl := newController(conf)
+	jobs := make(chan *internal.ScrollResponse)
+	ctl.pool = newWorkerPool(jobs, func(id int) (*internal.SubProcess, error) {
+		return nil, nil
+	}, func(job *internal.ScrollResponse, fixer *internal.SubProcess) {})
+	if err := ctl.pool.Resize(2); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := ctl.handler()
+	tests := []struct {
+		name   string
+		method string
+		uri    string
+		status int
+		check  func(st *Status) bool
+	}{
+		{
+			name:   "status",
+			method: http.MethodGet,
+			uri:    "/status",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return st.BulkWorker == 2 && len(st.Workers) == 2 && !st.Paused
+			},
+		},
+		{
+			name:   "pause with get",
+			method: http.MethodGet,
+			uri:    "/pause",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "pause",
+			method: http.MethodPost,
+			uri:    "/pause",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return st.Paused
+			},
+		},
+		{
+			name:   "resume",
+			method: http.MethodPost,
+			uri:    "/resume",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return !st.Paused
+			},
+		},
+		{
+			name:   "throttle",
+			method: http.MethodPost,
+			uri:    "/throttle?docs_per_sec=100&bytes_per_sec=2000",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return st.Throttle["docs_per_sec"] == 100 && st.Throttle["bytes_per_sec"] == 2000
+			},
+		},
+		{
+			name:   "throttle keep bytes",
+			method: http.MethodPost,
+			uri:    "/throttle?docs_per_sec=0",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return st.Throttle["docs_per_sec"] == 0 && st.Throttle["bytes_per_sec"] == 2000
+			},
+		},
+		{
+			name:   "throttle invalid",
+			method: http.MethodPost,
+			uri:    "/throttle?docs_per_sec=-1",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "workers",
+			method: http.MethodPost,
+			uri:    "/workers?n=4",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return st.BulkWorker == 4 && st.Workers[3].ID == 3
+			},
+		},
+		{
+			name:   "workers shrink",
+			method: http.MethodPost,
+			uri:    "/workers?n=1",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return st.BulkWorker == 1 && st.Workers[0].ID == 0 && st.Workers[0].State != workerStopping
+			},
+		},
+		{
+			name:   "workers invalid",
+			method: http.MethodPost,
+			uri:    "/workers?n=0",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "stop",
+			method: http.MethodPost,
+			uri:    "/stop",
+			status: http.StatusOK,
+			check: func(st *Status) bool {
+				return st.Stopping
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.uri, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d, body=%s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.check == nil {
+				return
+			}
+			st := &Status{}
+			if err := json.Unmarshal(w.Body.Bytes(), st); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(st) {
+				t.Errorf("unexpected status: %s", w.Body.String())
+			}
+		})
+	}
+
+	ctl.pool.Close()
+	ctl.pool.Wait()
+}
+
+func TestWorkerPool_Resize(t *testing.T) {
+	jobs := make(chan *internal.ScrollResponse)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	pool := newWorkerPool(jobs, func(id int) (*internal.SubProcess, error) {
+		return nil, nil
+	}, func(job *internal.ScrollResponse, fixer *internal.SubProcess) {
+		started <- struct{}{}
+		<-release
+	})
+	if err := pool.Resize(2); err != nil {
+		t.Fatal(err)
+	}
+	jobs <- &internal.ScrollResponse{}
+	jobs <- &internal.ScrollResponse{}
+	<-started
+	<-started
+	if err := pool.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 正在处理数据的 worker 退出前仍在列表中
+	states := pool.States()
+	if len(states) != 2 || states[0].State != workerBusy || states[1].State != workerStopping {
+		t.Errorf("States() = %+v", states)
+	}
+	if n := pool.Size(); n != 1 {
+		t.Errorf("Size() = %d, want 1", n)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for len(pool.States()) != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if states = pool.States(); len(states) != 1 || states[0].ID != 0 {
+		t.Errorf("States() after stopped = %+v", states)
+	}
+
+	pool.Close()
+	if err := pool.Resize(3); err == nil {
+		t.Error("Resize() after Close() should fail")
+	}
+	pool.Wait()
+	if n := pool.Size(); n != 0 {
+		t.Errorf("Size() after Wait() = %d, want 0", n)
+	}
+}
+
+func TestController_WaitResume(t *testing.T) {
+	ctl := newController(&Config{})
+	ctl.Pause()
+	done := make(chan struct{})
+	go func() {
+		ctl.WaitResume()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("WaitResume returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	ctl.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("WaitResume not returned after stop")
+	}
+	if ctl.Stop() {
+		t.Error("Stop() should return false when called again")
+	}
+}
+
+func TestCheckLoopback(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr bool
+	}{
+		{addr: "127.0.0.1:8090"},
+		{addr: "[::1]:8090"},
+		{addr: "localhost:8090"},
+		{addr: ":8090", wantErr: true},
+		{addr: "0.0.0.0:8090", wantErr: true},
+		{addr: "10.0.0.1:8090", wantErr: true},
+		{addr: "127.0.0.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if err := checkLoopback(tt.addr); (err != nil) != tt.wantErr {
+				t.Errorf("checkLoopback() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
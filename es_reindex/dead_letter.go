@@ -0,0 +1,30 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package main
+
+import (
+	"os"
+
+	"github.com/hidu/es-tools/internal"
+)
+
+// replayDeadLetter 读取 dead_letter_file，每 size 条数据组成一页调用 fn，fn 返回 false 时停止读取
+func replayDeadLetter(fileName string, size int, fn func(sr *internal.ScrollResponse) bool) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	finished, err := internal.ReadPages(f, size, internal.NewDataItemFromDeadLetter, fn)
+	if err != nil || !finished {
+		return err
+	}
+	// 和 scroll 一样，最后返回一个空页
+	fn(internal.NewScrollResponse(nil))
+	return nil
+}
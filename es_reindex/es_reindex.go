@@ -15,9 +15,9 @@ import (
 	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -39,14 +39,18 @@ func (i *IndexInfo) IndexURI() string {
 
 // Config 配置信息
 type Config struct {
-	OriginIndex   *IndexInfo             `json:"origin_index"`
-	NewIndex      *IndexInfo             `json:"new_index"`
-	ScanQuery     *internal.Query        `json:"scan_query"`
-	ScanTime      string                 `json:"scan_time"`
-	FieldsDefault map[string]interface{} `json:"fields_default"`
-	DataFixCmd    string                 `json:"data_fix_cmd"`
+	OriginIndex *IndexInfo      `json:"origin_index"`
+	NewIndex    *IndexInfo      `json:"new_index"`
+	ScanQuery   *internal.Query `json:"scan_query"`
+	ScanTime    string          `json:"scan_time"`
+
+	// IfSeqNo 写回原索引时使用 if_seq_no、if_primary_term，读取之后被修改过的数据不会被覆盖，es >= 6.7
+	IfSeqNo bool `json:"if_seq_no"`
+
+	internal.WriteConfig
 
 	sameIndex bool
+	scanTime  int // scan_time 的秒数
 }
 
 // String 序列化
@@ -57,49 +61,121 @@ func (c *Config) String() string {
 
 // CounterType 计数器
 type CounterType struct {
-	start     time.Time
-	total     uint64 // scroll 的总数
-	read      uint64 // 当前已读总数
-	writeSkip uint64
-	writeBulk uint64
-	bulkC     uint64
+	*internal.WriteCounter
+	total uint64 // scroll 的总数
+
+	sliceRead  []uint64 // 每个 slice 已读总数
+	sliceTotal []uint64 // 每个 slice 的总数
 }
 
 func (c *CounterType) String() string {
-	return fmt.Sprintf("counter[read=%d/%d skip=%d bulk_no=%d bulk_total=%d]", c.read, c.total, c.writeSkip, c.bulkC, c.writeBulk)
+	str := fmt.Sprintf("counter[read=%d/%d %s]", c.Read(), atomic.LoadUint64(&c.total), c.Summary())
+	if len(c.sliceRead) < 2 {
+		return str
+	}
+	slices := make([]string, 0, len(c.sliceRead))
+	for i := range c.sliceRead {
+		slices = append(slices, fmt.Sprintf("%d:%d/%d", i, atomic.LoadUint64(&c.sliceRead[i]), atomic.LoadUint64(&c.sliceTotal[i])))
+	}
+	return fmt.Sprintf("%s slices[%s]", str, strings.Join(slices, " "))
 }
 
-// PrintLog 打印输出，会依据处理梳理，估算出大致完成的时间
-func (c *CounterType) PrintLog() {
-	if c.total > 0 {
-		finishRate := float64(c.read) / float64(c.total)
-		used := time.Now().Sub(c.start)
-		need := float64(c.total-c.read) / (float64(c.read) / used.Seconds())
+// InitSlices 初始化每个 slice 的计数器
+func (c *CounterType) InitSlices(n int) {
+	c.sliceRead = make([]uint64, n)
+	c.sliceTotal = make([]uint64, n)
+}
 
-		finishTime := time.Now().Add(time.Duration(need) * time.Second)
+// AddRead 记录 slice 读取到的数据
+func (c *CounterType) AddRead(slice int, total uint64, num int) {
+	if atomic.CompareAndSwapUint64(&c.sliceTotal[slice], 0, total) {
+		var sum uint64
+		for i := range c.sliceTotal {
+			sum += atomic.LoadUint64(&c.sliceTotal[i])
+		}
+		atomic.StoreUint64(&c.total, sum)
+	}
+	atomic.AddUint64(&c.sliceRead[slice], uint64(num))
+	c.WriteCounter.AddRead(num)
+}
 
-		log.Printf("%s rate=%.2f%% need=%.1fs finish_time=%s", c, 100*finishRate, need, finishTime.Format("2006-01-02 15:04:05"))
-	} else {
-		log.Println(c)
+// Restore 从断点恢复计数器
+func (c *CounterType) Restore(cp *internal.Checkpoint) {
+	c.total = cp.Total
+	c.sliceTotal[0] = cp.Total
+	c.sliceRead[0] = cp.Pos
+	c.WriteCounter.Restore(cp.Pos)
+}
+
+// Progress 已读取的百分比、读取速度(条/秒)和预计剩余的秒数，总数未知时 need 为 -1
+func (c *CounterType) Progress() (finishRate float64, speed float64, need float64) {
+	read := c.Read()
+	total := atomic.LoadUint64(&c.total)
+	if used := c.Elapsed().Seconds(); used > 0 {
+		speed = float64(read) / used
+	}
+	need = -1
+	if total > 0 {
+		finishRate = float64(read) / float64(total)
+		if speed > 0 && total >= read {
+			need = float64(total-read) / speed
+		}
 	}
+	return finishRate, speed, need
+}
+
+// PrintLog 打印输出，会依据处理梳理，估算出大致完成的时间
+func (c *CounterType) PrintLog() {
+	finishRate, _, need := c.Progress()
+	internal.LogProgress(c, finishRate, need)
 }
 
 var conf = flag.String("conf", "es_reindex.json", "reindex config file name")
-var loopSleep = flag.Int64("loop_sleep", 0, "each loop sleep time")
+var loopSleep = flag.Int64("loop_sleep", 0, "sleep milliseconds after each scroll page is read")
 var bulkWorker = flag.Int("bulk_worker", 3, "bulk worker num")
 var isDebug = flag.Bool("debug", false, "debug and print")
+var checkpointFile = flag.String("checkpoint", "", "checkpoint file, read with search_after and save the progress to it")
+var resume = flag.Bool("resume", false, "resume from the checkpoint file")
+var slices = flag.Int("slices", 1, "sliced scroll num, read in parallel")
+var replayFile = flag.String("replay", "", "replay the dead letter file, write the failed items again")
+var readerKind = flag.String("reader", internal.ReaderAuto, "read with: auto, scroll, pit(point in time, es >= 7.12)")
+var httpAddr = flag.String("http", "", "local http control server address, eg 127.0.0.1:8090, disabled when empty")
+var httpPublic = flag.Bool("http_public", false, "allow the -http server to listen on a non-loopback address, the control api has no authentication")
+
+// batcher 所有 bulk_worker 共用，将数据重新分组后发送 bulk 请求
+var batcher *internal.BulkBatcher
+
+// readers 正在使用的 Reader，退出前需要关闭
+var readers []internal.Reader
+
+// deadLetter bulk 失败的数据写入文件，未配置 dead_letter_file 时为 nil
+var deadLetter *internal.DeadLetterWriter
 
 var counter = &CounterType{
-	start: time.Now(),
+	WriteCounter: internal.NewWriteCounter(),
 }
 
 func main() {
 	flag.Parse()
+	if *resume && *checkpointFile == "" {
+		fmt.Println("-resume requires -checkpoint")
+		os.Exit(2)
+	}
+	if *checkpointFile != "" {
+		// readConf 会切换工作目录，所以先转换为绝对路径
+		*checkpointFile, _ = filepath.Abs(*checkpointFile)
+	}
+	if *replayFile != "" {
+		*replayFile, _ = filepath.Abs(*replayFile)
+	}
+	*conf, _ = filepath.Abs(*conf)
+
 	config, err := readConf(*conf)
 	if err != nil {
 		fmt.Println("parser config failed:", err)
 		os.Exit(2)
 	}
+	internal.HandleReload(*conf, config.Throttler())
 
 	reIndex(config)
 }
@@ -122,6 +198,11 @@ func readConf(confName string) (*Config, error) {
 	if conf.ScanTime == "" {
 		conf.ScanTime = "120s"
 	}
+	scanTime, err := time.ParseDuration(conf.ScanTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scan_time %q: %w", conf.ScanTime, err)
+	}
+	conf.scanTime = int(scanTime.Seconds())
 
 	if conf.OriginIndex == nil {
 		log.Fatalln("origin_index is empty")
@@ -154,85 +235,187 @@ func readConf(confName string) (*Config, error) {
 		conf.ScanQuery = internal.NewQuery()
 	}
 
-	if conf.FieldsDefault == nil {
-		conf.FieldsDefault = make(map[string]interface{})
-	}
-	conf.DataFixCmd = strings.TrimSpace(conf.DataFixCmd)
-	if strings.HasPrefix(conf.DataFixCmd, "#") {
-		log.Println("ignore data fix cmd:", conf.DataFixCmd)
-		conf.DataFixCmd = ""
+	conf.sameIndex = conf.OriginIndex.IndexURI() == conf.NewIndex.IndexURI()
+
+	conf.Debug = *isDebug
+	if err = conf.WriteConfig.Init(conf.NewIndex.Host, conf.NewIndex.DocType, *replayFile); err != nil {
+		return nil, err
 	}
 
-	conf.sameIndex = conf.OriginIndex.IndexURI() == conf.NewIndex.IndexURI()
+	if err = conf.initVersion(); err != nil {
+		return nil, err
+	}
 
 	return conf, nil
 }
 
+// initVersion 检查版本控制的配置，并在查询中返回 _version 或者 _seq_no
+func (c *Config) initVersion() error {
+	if c.PreserveVersion != "" {
+		(*c.ScanQuery)["version"] = true
+	}
+	if !c.IfSeqNo {
+		return nil
+	}
+	if c.PreserveVersion != "" {
+		return fmt.Errorf("preserve_version and if_seq_no can not be used together")
+	}
+	if !c.sameIndex {
+		return fmt.Errorf("if_seq_no requires new_index to be the same as origin_index")
+	}
+	if !c.OriginIndex.Host.Vs.Gte("6.7.0") {
+		return fmt.Errorf("if_seq_no requires es version >= 6.7.0")
+	}
+	(*c.ScanQuery)["seq_no_primary_term"] = true
+	return nil
+}
+
 func checkErr(msg string, err error) {
 	if err != nil {
+		closeReaders()
 		log.Fatalln(msg, err, counter.String())
 	}
 }
 
+// closeReaders 保存断点，并清除 scroll 上下文或关闭 point in time
+func closeReaders() {
+	for _, r := range readers {
+		if err := r.SaveCheckpoint(); err != nil {
+			log.Println("[err] save checkpoint failed:", err)
+		}
+		if err := r.Close(); err != nil {
+			log.Println("[err] close reader failed:", err)
+		}
+	}
+}
+
 func reIndex(conf *Config) {
 	log.Println("[info] start re_index")
-	scroll := internal.NewScroll(conf.OriginIndex.Host, conf.OriginIndex.DocType, conf.ScanQuery)
+	var err error
+	if *replayFile == "" {
+		readers, err = internal.NewReaders(conf.OriginIndex.Host, conf.OriginIndex.DocType, conf.ScanQuery, &internal.ReaderOption{
+			Kind:     *readerKind,
+			Slices:   *slices,
+			ScanTime: conf.scanTime,
+		})
+		checkErr("create reader failed", err)
+		counter.InitSlices(len(readers))
+	} else {
+		log.Println("[info] replay dead letter file:", *replayFile)
+		conf.sameIndex = false
+		counter.InitSlices(1)
+	}
+
+	if *checkpointFile != "" && len(readers) > 0 {
+		reader := readers[0]
+		err = reader.EnableCheckpoint(*checkpointFile, *resume)
+		checkErr("enable checkpoint failed", err)
+		if *resume {
+			counter.Restore(reader.Checkpoint())
+		}
+		reader.SetCheckpointCounters(counter.Values)
+	}
+
+	writer, err := conf.NewBulkWriter(counter)
+	checkErr("open dead_letter_file failed", err)
+	deadLetter = writer.DeadLetter
+	defer deadLetter.Close()
+
+	ctl := newController(conf)
+	internal.HandleSignal(func() {
+		ctl.Stop()
+	}, closeReaders, counter.String)
 
 	scrollResultChan := make(chan *internal.ScrollResponse, *bulkWorker*5)
-	var wg sync.WaitGroup
-
-	for i := 0; i < *bulkWorker; i++ {
-		wg.Add(1)
-		go func(id int) {
-			log.Printf("[info] bulk_worker_start id=[%d]\n", id)
-
-			var fixer *internal.SubProcess
-			if conf.DataFixCmd != "" {
-				var _err error
-				fixer, _err = internal.NewSubProcess(conf.DataFixCmd, strconv.Itoa(id))
-				checkErr("create SubProcess failed", _err)
+
+	batcher = conf.Bulk.NewBatcher(writer.Write)
+
+	newFixer := func(id int) (*internal.SubProcess, error) {
+		if conf.DataFixCmd == "" {
+			return nil, nil
+		}
+		return internal.NewSubProcess(conf.DataFixCmd, strconv.Itoa(id))
+	}
+	ctl.pool = newWorkerPool(scrollResultChan, newFixer, func(job *internal.ScrollResponse, fixer *internal.SubProcess) {
+		// 一页数据全部写入后才能确认
+		reBulk(conf, job, fixer, func() {
+			if len(readers) == 0 {
+				return
 			}
-			for job := range scrollResultChan {
-				reBulk(conf, job, fixer)
+			if err := readers[job.Slice()].Ack(job); err != nil {
+				log.Println("[err] save checkpoint failed:", err)
 			}
-			wg.Done()
+		})
+	})
+	checkErr("start bulk_worker failed", ctl.pool.Resize(*bulkWorker))
 
-			if fixer != nil {
-				fixer.Close()
-			}
-			log.Printf("[info] bulk_worker_finish id=[%d]", id)
-		}(i)
+	if *httpAddr != "" {
+		checkErr("start http server failed", ctl.Serve(*httpAddr, *httpPublic))
 	}
 
 	time_util.SetInterval(counter.PrintLog, 5)
 
 	log.Println("[info] started re_bulk worker,n=", *bulkWorker)
 
-	for {
-		sr, err := scroll.Next()
-		checkErr("scroll_next", err)
-
-		if counter.total == 0 {
-			counter.total = scroll.Total()
+	readFn := func(sr *internal.ScrollResponse) bool {
+		num := 0
+		if sr.HasMore() {
+			num = len(sr.Hits.Hits)
 		}
-
-		counter.read += uint64(len(sr.Hits.Hits))
-
+		var total uint64
+		if len(readers) > 0 {
+			total = readers[sr.Slice()].Total()
+		}
+		counter.AddRead(sr.Slice(), total, num)
 		scrollResultChan <- sr
-		if !sr.HasMore() {
-			log.Println("[info] no more message")
-			break
+		if *loopSleep > 0 {
+			time.Sleep(time.Duration(*loopSleep) * time.Millisecond)
 		}
+		// 暂停时在发出下一个 scroll 请求前等待
+		ctl.WaitResume()
+		return !internal.IsStopped(ctl.stop)
+	}
+	if *replayFile != "" {
+		err = replayDeadLetter(*replayFile, querySize(conf.ScanQuery), readFn)
+	} else {
+		err = internal.ReadSlices(readers, readFn)
+	}
+	checkErr("scroll_next", err)
+
+	interrupted := internal.IsStopped(ctl.stop)
+	if interrupted {
+		log.Println("[info] scroll stopped, wait bulk workers")
+	} else {
+		log.Println("[info] no more message")
 	}
 
-	close(scrollResultChan)
+	ctl.pool.Close()
+	ctl.pool.Wait()
+	batcher.Close()
+
+	closeReaders()
 
-	wg.Wait()
+	if interrupted {
+		log.Println("[info] bulkWorker all finished, interrupted re_index", counter.String())
+		deadLetter.Close()
+		os.Exit(internal.ExitInterrupted)
+	}
 
 	log.Println("[info] bulkWorker all finished, stop re_index", counter.String())
 }
 
-func reBulk(conf *Config, scrollResult *internal.ScrollResponse, fixer *internal.SubProcess) {
+// querySize scan_query 中的 size，未设置时为 100
+func querySize(q *internal.Query) int {
+	if n, ok := (*q)["size"].(json.Number); ok {
+		if size, err := n.Int64(); err == nil && size > 0 {
+			return int(size)
+		}
+	}
+	return 100
+}
+
+// reBulk 处理一页数据后交给 batcher 发送，这页数据全部写入后调用 done
+func reBulk(conf *Config, scrollResult *internal.ScrollResponse, fixer *internal.SubProcess, done func()) {
 	if *isDebug {
 		fmt.Println("rebulk", scrollResult.String())
 	}
@@ -240,108 +423,18 @@ func reBulk(conf *Config, scrollResult *internal.ScrollResponse, fixer *internal
 	hitsNum := len(scrollResult.Hits.Hits)
 
 	lines := make([]string, 0, hitsNum)
-	dataMap := make(map[string]string, hitsNum)
 
 	for _, item := range scrollResult.Hits.Hits {
-		if conf.NewIndex.DocType.Index != "" {
-			item.Index = conf.NewIndex.DocType.Index
-		}
-
-		if conf.NewIndex.DocType.Type != "" {
-			item.Type = conf.NewIndex.DocType.Type
-		}
-
-		_hasChange := false
-		for k, v := range conf.FieldsDefault {
-			if _, has := item.Source[k]; !has {
-				item.Source[k] = v
-				_hasChange = true
-			}
-		}
-
-		if fixer != nil {
-			_itemRawStr := string(item.JSONBytes())
-			var _res string
-			var _err error
-			try := 0
-
-			for {
-				try++
-				_res, _err = fixer.Deal(_itemRawStr)
-				if _err != nil {
-					log.Println("[err] fixer_deal with error:", _err, "try_times=", try, "input=", _itemRawStr)
-					time.Sleep(1 * time.Second)
-					continue
-				}
-				// 若处理后，返回空字符串，则这条数据会跳过，不处理
-				if _res == "" {
-					break
-				}
-				_hasChange = _itemRawStr != _res
-
-				newItem, _err := internal.NewDataItem(_res)
-				if _err != nil {
-					log.Println("[err] fixer_data with error:", _err, "try_times=", try, "raw=", _itemRawStr, "new_str=", _res)
-					time.Sleep(1 * time.Second)
-					continue
-				}
-				if *isDebug {
-					fmt.Println("fixer >>>" + strings.Repeat("=", 70))
-					fmt.Println("raw:", _itemRawStr)
-					fmt.Println("new:", _res)
-				}
-				item = newItem
-				break
-			}
-
-			if _res == "" {
-				atomic.AddUint64(&counter.writeSkip, 1)
-				log.Println("[info] skip with empty resp:", item.UniqID())
-				continue
-			}
-		}
-
-		if !conf.sameIndex || _hasChange {
-			str := item.BulkString()
-			dataMap[item.UniqID()] = str
-			lines = append(lines, str)
-
-			atomic.AddUint64(&counter.writeBulk, 1)
-		} else {
-			atomic.AddUint64(&counter.writeSkip, 1)
+		// 写回原索引时，没有变化的数据不再写入
+		if line, changed := conf.BulkLine(item, fixer, conf.IfSeqNo); line != "" && (!conf.sameIndex || changed) {
+			lines = append(lines, line)
 		}
 	}
+	counter.AddWrite(len(lines), hitsNum-len(lines))
 
 	if len(lines) < 1 {
 		log.Println("[info] not change,skip reindex")
-		return
 	}
 
-	var brt internal.BulkResponse
-
-	err := conf.NewIndex.Host.BulkStream(strings.NewReader(strings.Join(lines, "\n")), &brt)
-	checkErr("parse bulk resp failed:", err)
-
-	// 	log.Println("bulk resp:", string(body))
-
-	if brt.Errors {
-		log.Println("[err] bulk resp has error")
-	} else {
-		log.Println("[info] bulk all success")
-	}
-
-	// 	t,_:=json.Marshal(br)
-	// 	fmt.Println("br",string(t))
-	for _, data := range brt.Items {
-		atomic.AddUint64(&counter.bulkC, 1)
-		if item, has := data["index"]; has {
-			_id := item.UniqID()
-			_raw, _ := dataMap[_id]
-			if item.Error != "" {
-				log.Printf("[err] bulk_err id=%s err=%s input=%s", _id, item.Error, strings.TrimSpace(_raw))
-			} else {
-				log.Printf("[info] bulk_suc id=%s s=%d", _id, item.Status)
-			}
-		}
-	}
+	batcher.Add(lines, done)
 }
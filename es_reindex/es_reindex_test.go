@@ -7,6 +7,8 @@
 package main
 
 import (
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/hidu/es-tools/internal"
@@ -52,3 +54,32 @@ func TestIndexInfo_IndexURI(t *testing.T) {
 		})
 	}
 }
+
+func TestCounterType_AddRead(t *testing.T) {
+	c := &CounterType{
+		WriteCounter: internal.NewWriteCounter(),
+	}
+	c.InitSlices(3)
+	var wg sync.WaitGroup
+	for slice := 0; slice < 3; slice++ {
+		wg.Add(1)
+		go func(slice int) {
+			defer wg.Done()
+			// 每个 slice 共 (slice+1)*100 条，每页 10 条，最后为空页
+			total := uint64((slice + 1) * 100)
+			for i := 0; i < (slice+1)*10; i++ {
+				c.AddRead(slice, total, 10)
+			}
+			c.AddRead(slice, total, 0)
+		}(slice)
+	}
+	wg.Wait()
+
+	if c.Read() != 600 || c.total != 600 {
+		t.Errorf("read = %d, total = %d, want 600", c.Read(), c.total)
+	}
+	want := "slices[0:100/100 1:200/200 2:300/300]"
+	if got := c.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("String() = %q, want suffix %q", got, want)
+	}
+}
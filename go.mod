@@ -1,8 +1,19 @@
 module github.com/hidu/es-tools
 
-go 1.14
+go 1.17
 
 require (
 	github.com/hidu/go-speed v0.0.0-20170311142608-d36c8ac046d9
 	github.com/hidu/goutils v0.0.0-20200101142021-b41af65ee94c
+	github.com/klauspost/compress v1.15.15
+	github.com/xitongsys/parquet-go v1.6.2
+)
+
+require (
+	github.com/apache/arrow/go/arrow v0.0.0-20200730104253-651201b0f516 // indirect
+	github.com/apache/thrift v0.14.2 // indirect
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/pierrec/lz4/v4 v4.1.8 // indirect
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
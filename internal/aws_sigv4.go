@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RequestSigner 请求签名，发送请求前调用，body 为实际发送的请求体
+type RequestSigner interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// AWSConfig Amazon OpenSearch Service(Amazon Elasticsearch Service) 的 SigV4 签名配置
+type AWSConfig struct {
+	// Region 区域，如 us-east-1，为空时读取环境变量 AWS_REGION、AWS_DEFAULT_REGION
+	Region string `json:"region"`
+
+	// Service 服务名，默认为 es，OpenSearch Serverless 为 aoss
+	Service string `json:"service"`
+
+	// AccessKey、SecretKey、SessionToken 访问凭证，支持 ${env:NAME}、${file:/path} 格式，
+	// 为空时依次读取环境变量 AWS_ACCESS_KEY_ID 等、共享凭证文件 ~/.aws/credentials
+	AccessKey    string `json:"access_key"`
+	SecretKey    string `json:"secret_key"`
+	SessionToken string `json:"session_token"`
+
+	// Profile 共享凭证文件中的 profile，为空时读取环境变量 AWS_PROFILE，默认为 default
+	Profile string `json:"profile"`
+}
+
+// NewSigner 读取凭证，创建 SigV4 签名
+func (c *AWSConfig) NewSigner() (*AWSSigner, error) {
+	s := &AWSSigner{
+		Region:  firstNonEmpty(c.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		Service: firstNonEmpty(c.Service, "es"),
+		now:     time.Now,
+	}
+	if s.Region == "" {
+		return nil, fmt.Errorf("aws.region is empty")
+	}
+
+	var err error
+	if c.AccessKey != "" {
+		if s.AccessKey, err = resolveSecret(c.AccessKey); err != nil {
+			return nil, fmt.Errorf("read aws.access_key failed: %w", err)
+		}
+		if s.SecretKey, err = resolveSecret(c.SecretKey); err != nil {
+			return nil, fmt.Errorf("read aws.secret_key failed: %w", err)
+		}
+		if s.SessionToken, err = resolveSecret(c.SessionToken); err != nil {
+			return nil, fmt.Errorf("read aws.session_token failed: %w", err)
+		}
+	} else if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		s.AccessKey = id
+		s.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	} else {
+		profile := firstNonEmpty(c.Profile, os.Getenv("AWS_PROFILE"), "default")
+		values, err := readAWSCredentials(awsCredentialsFile(), profile)
+		if err != nil {
+			return nil, err
+		}
+		s.AccessKey = values["aws_access_key_id"]
+		s.SecretKey = values["aws_secret_access_key"]
+		s.SessionToken = values["aws_session_token"]
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("aws access key or secret key is empty")
+	}
+	return s, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func awsCredentialsFile() string {
+	if name := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); name != "" {
+		return name
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".aws", "credentials")
+}
+
+// readAWSCredentials 读取共享凭证文件(ini 格式)中 profile 的配置
+func readAWSCredentials(fileName string, profile string) (map[string]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("read aws credentials failed: %w", err)
+	}
+	defer f.Close()
+
+	var values map[string]string
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section == profile {
+				values = make(map[string]string)
+			}
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		arr := strings.SplitN(line, "=", 2)
+		if len(arr) == 2 {
+			values[strings.TrimSpace(arr[0])] = strings.TrimSpace(arr[1])
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if values == nil {
+		return nil, fmt.Errorf("aws profile %q not found in %q", profile, fileName)
+	}
+	return values, nil
+}
+
+// AWSSigner AWS Signature Version 4 签名
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+type AWSSigner struct {
+	Region       string
+	Service      string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	now func() time.Time
+}
+
+const awsTimeFormat = "20060102T150405Z"
+
+// Sign 给请求添加 X-Amz-Date、Authorization 等 header
+func (s *AWSSigner) Sign(req *http.Request, body []byte) error {
+	t := s.now().UTC()
+	amzDate := t.Format(awsTimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	// 只签名 host、content-type 和 x-amz-* header，其他 header 可能会被代理修改
+	headers := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		name := strings.ToLower(k)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(vs, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.Join(strings.Fields(headers[name]), " ") + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsCanonicalURI(req.URL.EscapedPath()),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	date := t.Format("20060102")
+	scope := strings.Join([]string{date, s.Region, s.Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	for _, v := range []string{s.Region, s.Service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+	return nil
+}
+
+// awsCanonicalURI 除 s3 外，路径需要在 url 编码的基础上再编码一次
+func awsCanonicalURI(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return awsEscape(path, false)
+}
+
+func awsCanonicalQuery(query map[string][]string) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(query))
+	for _, k := range keys {
+		vs := append([]string(nil), query[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape 按照 RFC 3986 编码，只保留 A-Z a-z 0-9 - _ . ~
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(bs []byte) string {
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAWSSigner() *AWSSigner {
+	return &AWSSigner{
+		Region:    "us-east-1",
+		Service:   "service",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		now: func() time.Time {
+			return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+}
+
+// TestAWSSigner_Sign 使用 aws sig-v4 测试套件中的 get-vanilla 用例
+func TestAWSSigner_Sign(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.amazonaws.com/", nil)
+	if err := testAWSSigner().Sign(req, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q, want %q", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %q", got)
+	}
+}
+
+func TestHost_Signer(t *testing.T) {
+	signer := testAWSSigner()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got := r.Header.Get("Authorization")
+
+		// 使用相同的凭证重新计算签名
+		req, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		if err := signer.Sign(req, body); err != nil || got != req.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"The request signature we calculated does not match"}`))
+			return
+		}
+		w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+	}))
+	defer ts.Close()
+
+	h := &Host{
+		Address: ts.URL,
+		Signer:  signer,
+	}
+	if err := h.Init(); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	var res ResponseBase
+	if err := h.DoRequest("POST", "/a,b/_search?scroll=1m&size=10", `{"query":{"match_all":{}}}`, &res); err != nil {
+		t.Errorf("DoRequest() error = %v", err)
+	}
+}
+
+func TestAWSConfig_NewSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es_tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	credFile := filepath.Join(dir, "credentials")
+	cred := strings.Join([]string{
+		"[default]",
+		"aws_access_key_id = AK_DEFAULT",
+		"aws_secret_access_key = SK_DEFAULT",
+		"# comment",
+		"[prod]",
+		"aws_access_key_id=AK_PROD",
+		"aws_secret_access_key=SK_PROD",
+		"aws_session_token=TOKEN_PROD",
+	}, "\n")
+	if err = ioutil.WriteFile(credFile, []byte(cred), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	defer os.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.Getenv("AWS_SHARED_CREDENTIALS_FILE"))
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", credFile)
+
+	tests := []struct {
+		name      string
+		conf      *AWSConfig
+		env       map[string]string
+		wantKey   string
+		wantToken string
+		wantErr   bool
+	}{
+		{
+			name:    "no region",
+			conf:    &AWSConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "default profile",
+			conf:    &AWSConfig{Region: "us-east-1"},
+			wantKey: "AK_DEFAULT",
+		},
+		{
+			name:      "profile",
+			conf:      &AWSConfig{Region: "us-east-1", Profile: "prod"},
+			wantKey:   "AK_PROD",
+			wantToken: "TOKEN_PROD",
+		},
+		{
+			name:    "profile not found",
+			conf:    &AWSConfig{Region: "us-east-1", Profile: "test"},
+			wantErr: true,
+		},
+		{
+			name:    "env",
+			conf:    &AWSConfig{},
+			env:     map[string]string{"AWS_REGION": "us-west-2", "AWS_ACCESS_KEY_ID": "AK_ENV", "AWS_SECRET_ACCESS_KEY": "SK_ENV"},
+			wantKey: "AK_ENV",
+		},
+		{
+			name:    "config",
+			conf:    &AWSConfig{Region: "us-east-1", AccessKey: "AK_CONF", SecretKey: "${env:TEST_AWS_SK}"},
+			env:     map[string]string{"TEST_AWS_SK": "SK_CONF"},
+			wantKey: "AK_CONF",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				os.Setenv(k, v)
+				defer os.Unsetenv(k)
+			}
+			s, err := tt.conf.NewSigner()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSigner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if s.AccessKey != tt.wantKey || s.SecretKey == "" || s.SessionToken != tt.wantToken {
+				t.Errorf("NewSigner() = %+v", s)
+			}
+			if s.Service != "es" {
+				t.Errorf("Service = %q, want es", s.Service)
+			}
+		})
+	}
+}
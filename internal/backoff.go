@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff 指数退避，第 n 次重试等待 Base*2^(n-1)，最大为 Max，并加入随机抖动
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Duration 第 attempt 次重试前需要等待的时间，attempt 从 1 开始，
+// 结果在 [d/2, d] 之间随机，避免多个 worker 同时重试
+func (b *Backoff) Duration(attempt int) time.Duration {
+	d := b.Base
+	for i := 1; i < attempt && (b.Max <= 0 || d < b.Max); i++ {
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
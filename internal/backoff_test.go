@@ -0,0 +1,39 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff_Duration(t *testing.T) {
+	b := &Backoff{
+		Base: 100 * time.Millisecond,
+		Max:  time.Second,
+	}
+	tests := []struct {
+		name    string
+		attempt int
+		max     time.Duration
+	}{
+		{name: "attempt 1", attempt: 1, max: 100 * time.Millisecond},
+		{name: "attempt 2", attempt: 2, max: 200 * time.Millisecond},
+		{name: "attempt 4", attempt: 4, max: 800 * time.Millisecond},
+		{name: "attempt 10 capped", attempt: 10, max: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				got := b.Duration(tt.attempt)
+				if got < tt.max/2 || got > tt.max {
+					t.Fatalf("Duration(%d) = %v, want in [%v, %v]", tt.attempt, got, tt.max/2, tt.max)
+				}
+			}
+		})
+	}
+}
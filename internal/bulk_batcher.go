@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BulkBatcher 将多个 worker 产生的 bulk 数据重新组合为 bulk 请求，
+// 每个请求的条数不超过 maxActions、大小不超过 maxBytes(单条数据超过 maxBytes 时单独发送)，
+// 数据不足时每隔 interval 发送一次，可并发调用
+type BulkBatcher struct {
+	maxActions int
+	maxBytes   int
+	send       func(lines []string)
+
+	mu    sync.Mutex
+	lines []string
+	refs  []*batchRef
+	size  int
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// batchRef 一次 Add 的数据，全部发送后调用 done
+type batchRef struct {
+	remaining int32
+	done      func()
+}
+
+// bulkBatch 一个 bulk 请求的数据
+type bulkBatch struct {
+	lines []string
+	refs  []*batchRef
+}
+
+// NewBulkBatcher 创建 BulkBatcher，send 用于发送一个 bulk 请求，返回后认为数据已处理完成
+func NewBulkBatcher(maxActions int, maxBytes int, interval time.Duration, send func(lines []string)) *BulkBatcher {
+	b := &BulkBatcher{
+		maxActions: maxActions,
+		maxBytes:   maxBytes,
+		send:       send,
+		stop:       make(chan struct{}),
+	}
+	if interval > 0 {
+		b.wg.Add(1)
+		go b.flushLoop(interval)
+	}
+	return b
+}
+
+// Add 添加数据，每个元素为一条 bulk 数据(action 行 + source 行)，
+// 数据满足一个请求时在当前 goroutine 中发送，全部发送后调用 done(可以为 nil)
+func (b *BulkBatcher) Add(lines []string, done func()) {
+	if len(lines) == 0 {
+		if done != nil {
+			done()
+		}
+		return
+	}
+	ref := &batchRef{
+		remaining: int32(len(lines)),
+		done:      done,
+	}
+	var batches []*bulkBatch
+	b.mu.Lock()
+	for _, line := range lines {
+		size := len(line) + 1
+		if len(b.lines) > 0 && ((b.maxActions > 0 && len(b.lines) >= b.maxActions) || (b.maxBytes > 0 && b.size+size > b.maxBytes)) {
+			batches = append(batches, b.cut())
+		}
+		b.lines = append(b.lines, line)
+		b.refs = append(b.refs, ref)
+		b.size += size
+	}
+	if b.maxActions > 0 && len(b.lines) >= b.maxActions {
+		batches = append(batches, b.cut())
+	}
+	b.mu.Unlock()
+
+	for _, batch := range batches {
+		b.flush(batch)
+	}
+}
+
+// cut 取出当前缓存的数据，需要持有锁
+func (b *BulkBatcher) cut() *bulkBatch {
+	batch := &bulkBatch{
+		lines: b.lines,
+		refs:  b.refs,
+	}
+	b.lines = nil
+	b.refs = nil
+	b.size = 0
+	return batch
+}
+
+func (b *BulkBatcher) flush(batch *bulkBatch) {
+	if batch == nil || len(batch.lines) == 0 {
+		return
+	}
+	b.send(batch.lines)
+	for _, ref := range batch.refs {
+		if atomic.AddInt32(&ref.remaining, -1) == 0 && ref.done != nil {
+			ref.done()
+		}
+	}
+}
+
+// Flush 发送缓存中的所有数据
+func (b *BulkBatcher) Flush() {
+	b.mu.Lock()
+	batch := b.cut()
+	b.mu.Unlock()
+	b.flush(batch)
+}
+
+func (b *BulkBatcher) flushLoop(interval time.Duration) {
+	defer b.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
+
+// Close 停止定时发送，并发送缓存中的所有数据，调用后不能再 Add
+func (b *BulkBatcher) Close() {
+	close(b.stop)
+	b.wg.Wait()
+	b.Flush()
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkBatcher(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxActions int
+		maxBytes   int
+		adds       [][]string
+		want       []int // 每个请求的条数
+	}{
+		{
+			name:       "max actions",
+			maxActions: 3,
+			adds:       [][]string{{"a", "b"}, {"c", "d"}, {"e", "f", "g", "h"}},
+			want:       []int{3, 3, 2},
+		},
+		{
+			name:     "max bytes",
+			maxBytes: 8,
+			adds:     [][]string{{"aaa", "bbb", "ccc"}, {"ddd"}},
+			want:     []int{2, 2},
+		},
+		{
+			name:       "line larger than max bytes",
+			maxActions: 10,
+			maxBytes:   4,
+			adds:       [][]string{{"a", strings.Repeat("b", 10), "c"}},
+			want:       []int{1, 1, 1},
+		},
+		{
+			name:       "empty",
+			maxActions: 10,
+			adds:       [][]string{{}, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			b := NewBulkBatcher(tt.maxActions, tt.maxBytes, 0, func(lines []string) {
+				got = append(got, len(lines))
+			})
+			done := 0
+			for _, lines := range tt.adds {
+				b.Add(lines, func() {
+					done++
+				})
+			}
+			b.Close()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batches = %v, want %v", got, tt.want)
+			}
+			if done != len(tt.adds) {
+				t.Errorf("done = %d, want %d", done, len(tt.adds))
+			}
+		})
+	}
+}
+
+func TestBulkBatcher_Interval(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	b := NewBulkBatcher(100, 0, 10*time.Millisecond, func(lines []string) {
+		mu.Lock()
+		got = append(got, lines...)
+		mu.Unlock()
+	})
+	defer b.Close()
+
+	doneCh := make(chan struct{})
+	b.Add([]string{"a", "b"}, func() {
+		close(doneCh)
+	})
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second):
+		t.Fatal("not flushed by interval")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("got %v", got)
+	}
+}
@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BulkConfig bulk 请求的配置，所有 worker 处理后的数据按照条数、大小重新分组发送
+type BulkConfig struct {
+	// MaxActions 每个请求最多的条数，默认为 1000
+	MaxActions int `json:"max_actions"`
+
+	// MaxBytes 每个请求最大的字节数，默认为 5MB，需要小于 es 的 http.max_content_length
+	MaxBytes int `json:"max_bytes"`
+
+	// FlushInterval 数据不足一个请求时，最长等待的时间，默认为 1s
+	FlushInterval string `json:"flush_interval"`
+
+	flushInterval time.Duration
+}
+
+// Init 设置默认值并检查配置
+func (b *BulkConfig) Init() error {
+	if b.MaxActions < 1 {
+		b.MaxActions = 1000
+	}
+	if b.MaxBytes < 1 {
+		b.MaxBytes = 5 << 20
+	}
+	if b.FlushInterval == "" {
+		b.FlushInterval = "1s"
+	}
+	var err error
+	if b.flushInterval, err = time.ParseDuration(b.FlushInterval); err != nil {
+		return fmt.Errorf("invalid bulk.flush_interval %q: %w", b.FlushInterval, err)
+	}
+	return nil
+}
+
+// NewBatcher 按照配置创建 BulkBatcher，需要先调用 Init
+func (b *BulkConfig) NewBatcher(send func(lines []string)) *BulkBatcher {
+	return NewBulkBatcher(b.MaxActions, b.MaxBytes, b.flushInterval, send)
+}
+
+// BulkRetry bulk 失败时的重试配置
+type BulkRetry struct {
+	// MaxAttempts 最多尝试的次数，包括第一次，默认为 5
+	MaxAttempts int `json:"max_attempts"`
+
+	// Backoff 第一次重试前等待的时间，之后每次翻倍，默认为 1s
+	Backoff string `json:"backoff"`
+
+	// MaxBackoff 最长的等待时间，默认为 60s
+	MaxBackoff string `json:"max_backoff"`
+
+	// Status 需要重试的状态码，默认为 429、503
+	Status []int `json:"status"`
+
+	backoff Backoff
+}
+
+// Init 设置默认值并检查配置
+func (r *BulkRetry) Init() error {
+	if r.MaxAttempts < 1 {
+		r.MaxAttempts = 5
+	}
+	if r.Backoff == "" {
+		r.Backoff = "1s"
+	}
+	if r.MaxBackoff == "" {
+		r.MaxBackoff = "60s"
+	}
+	if len(r.Status) == 0 {
+		r.Status = []int{429, 503}
+	}
+	var err error
+	if r.backoff.Base, err = time.ParseDuration(r.Backoff); err != nil {
+		return fmt.Errorf("invalid bulk_retry.backoff %q: %w", r.Backoff, err)
+	}
+	if r.backoff.Max, err = time.ParseDuration(r.MaxBackoff); err != nil {
+		return fmt.Errorf("invalid bulk_retry.max_backoff %q: %w", r.MaxBackoff, err)
+	}
+	return nil
+}
+
+// Retryable 状态码为 status 的数据是否需要重试
+func (r *BulkRetry) Retryable(status int) bool {
+	for _, s := range r.Status {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// BulkCounter 记录 bulk 写入的结果，可并发调用
+type BulkCounter interface {
+	// AddBulk done 为处理完成(成功或者失败)的条数，fail 为失败的条数，
+	// retry 为重试的条数，exists 为 create 时已存在而跳过的条数
+	AddBulk(done int, fail int, retry int, exists int)
+}
+
+// BulkWriter 发送 bulk 请求，可并发调用
+type BulkWriter struct {
+	Host     *Host
+	Retry    *BulkRetry
+	Throttle *Throttle
+
+	// DeadLetter 失败的数据写入该文件，为 nil 时只输出日志
+	DeadLetter *DeadLetterWriter
+
+	Counter BulkCounter
+}
+
+// Write 发送 bulk 请求，每个元素为一条 bulk 数据(action 行 + source 行)。
+// 状态码为 Retry.Status 的数据等待一段时间后只重发这部分数据，超过重试次数或者其他错误的数据写入 DeadLetter。
+// bulk 响应中的 items 和请求的数据顺序一致，不使用 _index、_type 匹配：写入别名或者不支持 _type 的集群时响应中的值和请求的不同。
+// 整个请求失败且不能重试时，所有数据以请求的状态码和错误写入 DeadLetter，不中断运行
+func (w *BulkWriter) Write(lines []string) {
+	retry := w.Retry
+	for attempt := 1; len(lines) > 0; attempt++ {
+		var brt BulkResponse
+
+		body := strings.Join(lines, "\n")
+		w.Throttle.Wait(len(lines), len(body))
+		start := time.Now()
+		err := w.Host.BulkStream(strings.NewReader(body), &brt)
+		latency := time.Since(start)
+		if esErr, ok := AsEsError(err); ok && esErr.IsOverload() {
+			w.Throttle.Feedback(latency, len(lines))
+		}
+		if esErr, ok := AsEsError(err); ok && retry.Retryable(esErr.Status) && attempt < retry.MaxAttempts {
+			// 整个请求被拒绝时全部重试
+			w.Counter.AddBulk(0, 0, len(lines), 0)
+			wait := retry.backoff.Duration(attempt)
+			log.Printf("[err] bulk failed, retry num=%d attempt=%d/%d wait=%s err=%s", len(lines), attempt, retry.MaxAttempts, wait, err)
+			time.Sleep(wait)
+			continue
+		}
+		if err != nil {
+			w.failAll(lines, err, attempt)
+			return
+		}
+
+		if brt.Errors {
+			log.Println("[err] bulk resp has error")
+		} else {
+			log.Println("[info] bulk all success")
+		}
+
+		var retryLines []string
+		var done, fail, exists, rejected int
+		for i, data := range brt.Items {
+			// 每一项只有一个 key，为操作类型：index、create、update、delete
+			var op string
+			var item *BulkResultItem
+			for k, v := range data {
+				op, item = k, v
+			}
+			if item == nil {
+				done++
+				continue
+			}
+			_id := item.UniqID()
+			var _raw string
+			if i < len(lines) {
+				_raw = lines[i]
+			}
+			if op == OpCreate && item.Status == http.StatusConflict {
+				// create 时数据已存在，跳过
+				done++
+				exists++
+				log.Printf("[info] bulk_exists id=%s", _id)
+				continue
+			}
+			if item.Status == http.StatusTooManyRequests {
+				rejected++
+			}
+			if item.Error != nil && retry.Retryable(item.Status) && attempt < retry.MaxAttempts {
+				retryLines = append(retryLines, _raw)
+				continue
+			}
+
+			done++
+			if item.Error != nil {
+				fail++
+				log.Printf("[err] bulk_err id=%s err=%s attempt=%d input=%s", _id, item.Error, attempt, strings.TrimSpace(_raw))
+				err = w.DeadLetter.Write(&DeadLetter{
+					ID:     _id,
+					Status: item.Status,
+					Error:  item.Error,
+					Bulk:   _raw,
+				})
+				if err != nil {
+					log.Println("[err] write dead_letter_file failed:", err)
+				}
+			} else {
+				log.Printf("[info] bulk_suc id=%s s=%d", _id, item.Status)
+			}
+		}
+		w.Counter.AddBulk(done, fail, len(retryLines), exists)
+
+		w.Throttle.Feedback(latency, rejected)
+
+		if len(retryLines) > 0 {
+			wait := retry.backoff.Duration(attempt)
+			log.Printf("[info] bulk_retry num=%d attempt=%d/%d wait=%s", len(retryLines), attempt, retry.MaxAttempts, wait)
+			time.Sleep(wait)
+		}
+		lines = retryLines
+	}
+}
+
+// failAll 整个请求失败时，将所有数据写入 DeadLetter
+func (w *BulkWriter) failAll(lines []string, err error, attempt int) {
+	var status int
+	if esErr, ok := AsEsError(err); ok {
+		status = esErr.Status
+	}
+	log.Printf("[err] bulk failed, num=%d attempt=%d status=%d err=%s", len(lines), attempt, status, err)
+	for _, line := range lines {
+		var _id string
+		if item, e := NewDataItemFromBulk(line); e == nil {
+			_id = item.UniqID()
+		}
+		dlErr := w.DeadLetter.Write(&DeadLetter{
+			ID:     _id,
+			Status: status,
+			Error:  err.Error(),
+			Bulk:   line,
+		})
+		if dlErr != nil {
+			log.Println("[err] write dead_letter_file failed:", dlErr)
+		}
+	}
+	w.Counter.AddBulk(len(lines), len(lines), 0, 0)
+}
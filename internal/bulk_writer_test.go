@@ -0,0 +1,206 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testBulkCounter 记录 done、fail、retry、exists
+type testBulkCounter struct {
+	mu     sync.Mutex
+	counts [4]int
+}
+
+func (c *testBulkCounter) AddBulk(done int, fail int, retry int, exists int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[0] += done
+	c.counts[1] += fail
+	c.counts[2] += retry
+	c.counts[3] += exists
+}
+
+func TestBulkWriter(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+			return
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(bs))
+		switch len(bodies) {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"type":"es_rejected_execution_exception"},"status":429}`))
+		case 2:
+			w.Write([]byte(`{"errors":true,"items":[
+{"index":{"_index":"t","_id":"1","status":201}},
+{"index":{"_index":"t","_id":"2","status":429,"error":{"type":"es_rejected_execution_exception"}}},
+{"create":{"_index":"t","_id":"3","status":409,"error":{"type":"version_conflict_engine_exception"}}},
+{"index":{"_index":"t","_id":"4","status":400,"error":{"type":"mapper_parsing_exception"}}}]}`))
+		default:
+			w.Write([]byte(`{"errors":false,"items":[{"index":{"_index":"t","_id":"2","status":201}}]}`))
+		}
+	}))
+	defer ts.Close()
+
+	host := &Host{Address: ts.URL}
+	if err := host.Init(); err != nil {
+		t.Fatal(err)
+	}
+	retry := &BulkRetry{Backoff: "1ms"}
+	if err := retry.Init(); err != nil {
+		t.Fatal(err)
+	}
+	throttle, _ := NewThrottle(&ThrottleConfig{})
+
+	dir, err := ioutil.TempDir("", "bulk_writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dlName := filepath.Join(dir, "dead_letter.json")
+	dl, err := NewDeadLetterWriter(dlName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := &testBulkCounter{}
+	w := &BulkWriter{
+		Host:       host,
+		Retry:      retry,
+		Throttle:   throttle,
+		DeadLetter: dl,
+		Counter:    counter,
+	}
+	lines := []string{
+		`{"index":{"_index":"t","_id":"1"}}` + "\n" + `{"a":1}` + "\n",
+		`{"index":{"_index":"t","_id":"2"}}` + "\n" + `{"a":2}` + "\n",
+		`{"create":{"_index":"t","_id":"3"}}` + "\n" + `{"a":3}` + "\n",
+		`{"index":{"_index":"t","_id":"4"}}` + "\n" + `{"a":"x"}` + "\n",
+	}
+	w.Write(lines)
+	dl.Close()
+
+	if len(bodies) != 3 {
+		t.Fatalf("bulk requests = %d, want 3", len(bodies))
+	}
+	if want := strings.Join(lines[1:2], "\n"); bodies[2] != want {
+		t.Errorf("retry body = %q, want %q", bodies[2], want)
+	}
+	// 整个请求重试 4 条，之后重试 1 条
+	if want := [4]int{4, 1, 5, 1}; counter.counts != want {
+		t.Errorf("counter = %v, want %v", counter.counts, want)
+	}
+
+	bs, _ := ioutil.ReadFile(dlName)
+	item, err := NewDataItemFromDeadLetter(strings.TrimSpace(string(bs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != "4" || item.Source["a"] != "x" {
+		t.Errorf("dead letter item = %s", item)
+	}
+}
+
+func TestBulkWriter_RequestFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		requests int
+	}{
+		{name: "not retryable", status: http.StatusRequestEntityTooLarge, requests: 1},
+		{name: "retry exhausted", status: http.StatusServiceUnavailable, requests: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/_bulk" {
+					w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+					return
+				}
+				requests++
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"error":{"type":"test_exception","reason":"failed"},"status":` + strconv.Itoa(tt.status) + `}`))
+			}))
+			defer ts.Close()
+
+			host := &Host{Address: ts.URL}
+			if err := host.Init(); err != nil {
+				t.Fatal(err)
+			}
+			retry := &BulkRetry{MaxAttempts: 2, Backoff: "1ms"}
+			if err := retry.Init(); err != nil {
+				t.Fatal(err)
+			}
+			throttle, _ := NewThrottle(&ThrottleConfig{})
+
+			dir, err := ioutil.TempDir("", "bulk_writer")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			dlName := filepath.Join(dir, "dead_letter.json")
+			dl, err := NewDeadLetterWriter(dlName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counter := &testBulkCounter{}
+			w := &BulkWriter{
+				Host:       host,
+				Retry:      retry,
+				Throttle:   throttle,
+				DeadLetter: dl,
+				Counter:    counter,
+			}
+			lines := []string{
+				`{"index":{"_index":"t","_id":"1"}}` + "\n" + `{"a":1}` + "\n",
+				`{"index":{"_index":"t","_id":"2"}}` + "\n" + `{"a":2}` + "\n",
+			}
+			w.Write(lines)
+			dl.Close()
+
+			if requests != tt.requests {
+				t.Errorf("bulk requests = %d, want %d", requests, tt.requests)
+			}
+			if want := [4]int{2, 2, 2 * (tt.requests - 1), 0}; counter.counts != want {
+				t.Errorf("counter = %v, want %v", counter.counts, want)
+			}
+
+			bs, _ := ioutil.ReadFile(dlName)
+			rows := strings.Split(strings.TrimSpace(string(bs)), "\n")
+			if len(rows) != len(lines) {
+				t.Fatalf("dead letter rows = %d, want %d", len(rows), len(lines))
+			}
+			for i, row := range rows {
+				var dlRow DeadLetter
+				if err := json.Unmarshal([]byte(row), &dlRow); err != nil {
+					t.Fatal(err)
+				}
+				if dlRow.Status != tt.status || dlRow.Bulk != lines[i] || !strings.Contains(fmt.Sprint(dlRow.Error), "test_exception") {
+					t.Errorf("dead letter[%d] = %s", i, row)
+				}
+				if want := "t||" + strconv.Itoa(i+1); dlRow.ID != want {
+					t.Errorf("dead letter[%d].ID = %q, want %q", i, dlRow.ID, want)
+				}
+			}
+		})
+	}
+}
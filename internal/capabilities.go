@@ -0,0 +1,73 @@
+package internal
+
+// 集群的发行版
+const (
+	DistElasticsearch = "elasticsearch"
+	DistOpenSearch    = "opensearch"
+)
+
+// openSearchCompatVersion opensearch 从 elasticsearch 7.10.2 分叉，比较版本时按此版本处理
+const openSearchCompatVersion = "7.10.2"
+
+// Capabilities 集群支持的功能，依据发行版和版本号确定
+type Capabilities struct {
+	// Types 请求路径和 bulk 数据中使用 _type：elasticsearch < 7.0。
+	// elasticsearch 7.x、opensearch 1.x 默认不使用 _type(已废弃)，elasticsearch 8.0、opensearch 2.0 不再支持
+	Types bool
+
+	// Parent 支持 _parent 父子文档：elasticsearch < 7.0
+	Parent bool
+
+	// Scan 支持 search_type=scan：elasticsearch < 5.0
+	Scan bool
+
+	// SearchAfter 支持 search_after 分页：elasticsearch >= 5.0
+	SearchAfter bool
+
+	// Slice 支持 sliced scroll：elasticsearch >= 5.0
+	Slice bool
+
+	// PIT 支持 point in time 和 _shard_doc 排序：elasticsearch >= 7.12，
+	// opensearch 的 point in time 接口与 elasticsearch 不同，暂不支持
+	PIT bool
+}
+
+// Distribution 集群的发行版：elasticsearch 或者 opensearch
+func (vs *ResponseVersion) Distribution() string {
+	if d, _ := vs.VersionData["distribution"].(string); d == DistOpenSearch {
+		return DistOpenSearch
+	}
+	return DistElasticsearch
+}
+
+// Number 集群的版本号
+func (vs *ResponseVersion) Number() string {
+	number, _ := vs.VersionData["number"].(string)
+	return number
+}
+
+// esNumber 对应的 elasticsearch 版本号，用于 Gt、Gte 比较
+func (vs *ResponseVersion) esNumber() string {
+	if vs.Distribution() == DistOpenSearch {
+		return openSearchCompatVersion
+	}
+	return vs.Number()
+}
+
+// Capabilities 集群支持的功能
+func (vs *ResponseVersion) Capabilities() *Capabilities {
+	if vs.Distribution() == DistOpenSearch {
+		return &Capabilities{
+			SearchAfter: true,
+			Slice:       true,
+		}
+	}
+	return &Capabilities{
+		Types:       !vs.Gte("7.0.0"),
+		Parent:      !vs.Gte("7.0.0"),
+		Scan:        !vs.Gte("5.0.0"),
+		SearchAfter: vs.Gte("5.0.0"),
+		Slice:       vs.Gte("5.0.0"),
+		PIT:         vs.Gte("7.12.0"),
+	}
+}
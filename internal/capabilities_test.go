@@ -0,0 +1,116 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResponseVersion_Capabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  map[string]interface{}
+		wantDist string
+		want     Capabilities
+		wantGt7  bool
+	}{
+		{
+			name:     "es 2.4",
+			version:  map[string]interface{}{"number": "2.4.6"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{Types: true, Parent: true, Scan: true},
+		},
+		{
+			name:     "es 4.6",
+			version:  map[string]interface{}{"number": "4.6.1"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{Types: true, Parent: true, Scan: true},
+		},
+		{
+			name:     "es 5.0.0",
+			version:  map[string]interface{}{"number": "5.0.0"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{Types: true, Parent: true, SearchAfter: true, Slice: true},
+		},
+		{
+			name:     "es 6.8",
+			version:  map[string]interface{}{"number": "6.8.0"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{Types: true, Parent: true, SearchAfter: true, Slice: true},
+		},
+		{
+			name:     "es 7.0.0",
+			version:  map[string]interface{}{"number": "7.0.0"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{SearchAfter: true, Slice: true},
+		},
+		{
+			name:     "es 7.11",
+			version:  map[string]interface{}{"number": "7.11.2"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{SearchAfter: true, Slice: true},
+			wantGt7:  true,
+		},
+		{
+			name:     "es 7.17",
+			version:  map[string]interface{}{"number": "7.17.0", "build_flavor": "default"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{SearchAfter: true, Slice: true, PIT: true},
+			wantGt7:  true,
+		},
+		{
+			name:     "es 8.0.0",
+			version:  map[string]interface{}{"number": "8.0.0"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{SearchAfter: true, Slice: true, PIT: true},
+			wantGt7:  true,
+		},
+		{
+			name:     "es 8.11",
+			version:  map[string]interface{}{"number": "8.11.1"},
+			wantDist: DistElasticsearch,
+			want:     Capabilities{SearchAfter: true, Slice: true, PIT: true},
+			wantGt7:  true,
+		},
+		{
+			name:     "opensearch 1.3",
+			version:  map[string]interface{}{"number": "1.3.2", "distribution": "opensearch"},
+			wantDist: DistOpenSearch,
+			want:     Capabilities{SearchAfter: true, Slice: true},
+			wantGt7:  true,
+		},
+		{
+			name:     "opensearch 2.11",
+			version:  map[string]interface{}{"number": "2.11.0", "distribution": "opensearch"},
+			wantDist: DistOpenSearch,
+			want:     Capabilities{SearchAfter: true, Slice: true},
+			wantGt7:  true,
+		},
+		{
+			name:     "opensearch compatibility mode",
+			version:  map[string]interface{}{"number": "7.10.2", "distribution": "opensearch"},
+			wantDist: DistOpenSearch,
+			want:     Capabilities{SearchAfter: true, Slice: true},
+			wantGt7:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vs := &ResponseVersion{VersionData: tt.version}
+			if got := vs.Distribution(); got != tt.wantDist {
+				t.Errorf("Distribution() = %v, want %v", got, tt.wantDist)
+			}
+			if got := vs.Capabilities(); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Capabilities() = %+v, want %+v", *got, tt.want)
+			}
+			if got := vs.Gt("7.0.0"); got != tt.wantGt7 {
+				t.Errorf("Gt(7.0.0) = %v, want %v", got, tt.wantGt7)
+			}
+		})
+	}
+}
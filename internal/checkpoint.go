@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpoint scroll 的断点信息，任务中断后可以从这里继续
+type Checkpoint struct {
+	// Query 原始的查询语句，续传时用于校验查询条件未变化
+	Query *Query `json:"query"`
+
+	// SearchAfter 最后一页已确认数据的排序值
+	SearchAfter []interface{} `json:"search_after"`
+
+	// PitID point in time 的 id，只有使用 point in time 读取时才有
+	PitID string `json:"pit_id,omitempty"`
+
+	// Pos 已确认处理的数据条数
+	Pos uint64 `json:"pos"`
+
+	// Total 匹配的数据总条数
+	Total uint64 `json:"total"`
+
+	// LoopNo 已确认处理的页数
+	LoopNo uint64 `json:"loop_no"`
+
+	// Counters 调用方的计数器
+	Counters map[string]uint64 `json:"counters"`
+
+	UpdateTime string `json:"update_time"`
+}
+
+// ReadCheckpoint 读取断点文件
+func ReadCheckpoint(fileName string) (*Checkpoint, error) {
+	bs, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var cp *Checkpoint
+	if err = jsonDecode(bs, &cp); err != nil {
+		return nil, err
+	}
+	if cp == nil || cp.Query == nil {
+		return nil, fmt.Errorf("invalid checkpoint file %q", fileName)
+	}
+	return cp, nil
+}
+
+// Save 将断点信息写入文件，先写临时文件再改名，避免写一半时进程退出导致文件损坏
+func (cp *Checkpoint) Save(fileName string) error {
+	cp.UpdateTime = time.Now().Format("2006-01-02 15:04:05")
+	bf, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), filepath.Base(fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(bf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fileName)
+}
+
+// withCheckpoint 为 Reader 提供断点相关的方法，cp 为 nil 时未开启断点续传
+type withCheckpoint struct {
+	cp *checkpointer
+}
+
+// Checkpoint 返回当前的断点信息，未开启断点续传时返回 nil
+func (w *withCheckpoint) Checkpoint() *Checkpoint {
+	if w.cp == nil {
+		return nil
+	}
+	w.cp.mu.Lock()
+	defer w.cp.mu.Unlock()
+	cp := w.cp.cp
+	return &cp
+}
+
+// SetCheckpointCounters 设置保存断点时需要一起保存的计数器
+func (w *withCheckpoint) SetCheckpointCounters(fn func() map[string]uint64) {
+	if w.cp != nil {
+		w.cp.counters = fn
+	}
+}
+
+// Ack 确认一页数据已处理完成，断点只会推进到连续确认的页
+func (w *withCheckpoint) Ack(sr *ScrollResponse) error {
+	if w.cp == nil || sr == nil || sr.seq == 0 {
+		return nil
+	}
+	return w.cp.ack(sr.seq)
+}
+
+// SaveCheckpoint 立即保存断点
+func (w *withCheckpoint) SaveCheckpoint() error {
+	if w.cp == nil {
+		return nil
+	}
+	return w.cp.save()
+}
+
+// pageMark 一页数据读取完成后的位置
+type pageMark struct {
+	searchAfter []interface{}
+	pos         uint64
+	pitID       string
+}
+
+// checkpointer 记录已读取和已确认的页，只有连续确认的页才会写入断点
+type checkpointer struct {
+	fileName string
+	interval time.Duration
+	counters func() map[string]uint64
+
+	mu       sync.Mutex
+	cp       Checkpoint
+	pending  map[uint64]*pageMark
+	acked    map[uint64]bool
+	lastSave time.Time
+}
+
+func newCheckpointer(fileName string, query *Query) *checkpointer {
+	return &checkpointer{
+		fileName: fileName,
+		interval: 5 * time.Second,
+		cp: Checkpoint{
+			Query: query,
+		},
+		pending:  make(map[uint64]*pageMark),
+		acked:    make(map[uint64]bool),
+		lastSave: time.Now(),
+	}
+}
+
+// load 读取断点文件用于续传，并校验查询语句没有变化
+func (c *checkpointer) load() (*Checkpoint, error) {
+	cp, err := ReadCheckpoint(c.fileName)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Query.String() != c.cp.Query.String() {
+		return nil, fmt.Errorf("query changed, checkpoint=%s, now=%s", cp.Query.String(), c.cp.Query.String())
+	}
+	c.mu.Lock()
+	c.cp = *cp
+	c.mu.Unlock()
+	return cp, nil
+}
+
+// read 记录读取到的一页数据
+func (c *checkpointer) read(seq uint64, mark *pageMark, total uint64) {
+	c.mu.Lock()
+	c.pending[seq] = mark
+	c.cp.Total = total
+	c.mu.Unlock()
+}
+
+// ack 确认一页数据已处理完成
+func (c *checkpointer) ack(seq uint64) error {
+	c.mu.Lock()
+	c.acked[seq] = true
+	advanced := false
+	for c.acked[c.cp.LoopNo+1] {
+		next := c.cp.LoopNo + 1
+		if mark := c.pending[next]; mark != nil {
+			c.cp.SearchAfter = mark.searchAfter
+			c.cp.Pos = mark.pos
+			c.cp.PitID = mark.pitID
+		}
+		delete(c.pending, next)
+		delete(c.acked, next)
+		c.cp.LoopNo = next
+		advanced = true
+	}
+	needSave := advanced && time.Since(c.lastSave) >= c.interval
+	c.mu.Unlock()
+
+	if needSave {
+		return c.save()
+	}
+	return nil
+}
+
+func (c *checkpointer) save() error {
+	var counters map[string]uint64
+	if c.counters != nil {
+		counters = c.counters()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cp.Counters = counters
+	c.lastSave = time.Now()
+	return c.cp.Save(c.fileName)
+}
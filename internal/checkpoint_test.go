@@ -0,0 +1,67 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointer_ack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es_tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "checkpoint.json")
+	query := &Query{"size": json.Number("10")}
+	c := newCheckpointer(fileName, query)
+	c.interval = 0
+	c.counters = func() map[string]uint64 {
+		return map[string]uint64{"read": 30}
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		c.read(i, &pageMark{searchAfter: []interface{}{json.Number("1")}, pos: i * 10}, 100)
+	}
+
+	tests := []struct {
+		name    string
+		ack     uint64
+		wantNo  uint64
+		wantPos uint64
+	}{
+		{name: "ack 2 before 1", ack: 2, wantNo: 0, wantPos: 0},
+		{name: "ack 1", ack: 1, wantNo: 2, wantPos: 20},
+		{name: "ack 3", ack: 3, wantNo: 3, wantPos: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.ack(tt.ack); err != nil {
+				t.Fatalf("ack() error = %v", err)
+			}
+			if c.cp.LoopNo != tt.wantNo || c.cp.Pos != tt.wantPos {
+				t.Errorf("ack() loopNo=%d pos=%d, want loopNo=%d pos=%d", c.cp.LoopNo, c.cp.Pos, tt.wantNo, tt.wantPos)
+			}
+		})
+	}
+
+	got, err := ReadCheckpoint(fileName)
+	if err != nil {
+		t.Fatalf("ReadCheckpoint() error = %v", err)
+	}
+	if got.Pos != 30 || got.Total != 100 || got.Counters["read"] != 30 {
+		t.Errorf("ReadCheckpoint() = %+v", got)
+	}
+	if got.Query.String() != query.String() {
+		t.Errorf("ReadCheckpoint() query = %s, want %s", got.Query.String(), query.String())
+	}
+}
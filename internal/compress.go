@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 文件的压缩方式
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// CheckCompress 检查压缩方式，为空时依据文件的扩展名(.gz、.zst)判断
+func CheckCompress(kind string, name string) (string, error) {
+	switch kind {
+	case CompressNone, CompressGzip, CompressZstd:
+		return kind, nil
+	case "":
+		return CompressOf(name), nil
+	default:
+		return "", fmt.Errorf("invalid compress %q, should be one of: none, gzip, zstd", kind)
+	}
+}
+
+// CompressOf 依据文件的扩展名判断压缩方式
+func CompressOf(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return CompressGzip
+	case strings.HasSuffix(name, ".zst"), strings.HasSuffix(name, ".zstd"):
+		return CompressZstd
+	default:
+		return CompressNone
+	}
+}
+
+// CompressWriter 压缩的 Writer，Flush 后已写入的数据都可以被解压，Close 不会关闭底层的 Writer
+type CompressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// NewCompressWriter 创建 kind 方式压缩的 Writer
+func NewCompressWriter(w io.Writer, kind string) (CompressWriter, error) {
+	switch kind {
+	case CompressNone, "":
+		return nopCompressWriter{w}, nil
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("invalid compress %q", kind)
+	}
+}
+
+type nopCompressWriter struct {
+	io.Writer
+}
+
+func (nopCompressWriter) Flush() error {
+	return nil
+}
+
+func (nopCompressWriter) Close() error {
+	return nil
+}
+
+// NewDecompressReader 依据数据开头的 magic number 判断压缩方式(gzip、zstd)并解压，未压缩时直接读取，
+// 多个压缩文件拼接在一起时也可以读取，Close 不会关闭底层的 Reader
+func NewDecompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(br), nil
+	}
+}
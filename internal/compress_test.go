@@ -0,0 +1,75 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCheckCompress(t *testing.T) {
+	tests := []struct {
+		kind    string
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "data.json", want: CompressNone},
+		{name: "data.json.gz", want: CompressGzip},
+		{name: "data.json.zst", want: CompressZstd},
+		{kind: CompressGzip, name: "data.json", want: CompressGzip},
+		{kind: "lz4", name: "data.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := CheckCompress(tt.kind, tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckCompress(%q, %q) error = %v, wantErr %v", tt.kind, tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("CheckCompress(%q, %q) = %q, want %q", tt.kind, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewCompressWriter(t *testing.T) {
+	data := []byte("{\"_id\":\"1\"}\n")
+	for _, kind := range []string{CompressNone, CompressGzip, CompressZstd} {
+		var buf bytes.Buffer
+		w, err := NewCompressWriter(&buf, kind)
+		if err != nil {
+			t.Fatal(kind, err)
+		}
+		w.Write(data)
+		if err = w.Flush(); err != nil {
+			t.Fatal(kind, err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(kind, err)
+		}
+		// 两次写入的数据拼接在一起
+		twice := append(append([]byte{}, buf.Bytes()...), buf.Bytes()...)
+		r, err := NewDecompressReader(bytes.NewReader(twice))
+		if err != nil {
+			t.Fatal(kind, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if want := append(append([]byte{}, data...), data...); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: got %q, err=%v", kind, got, err)
+		}
+	}
+
+	r, err := NewDecompressReader(bytes.NewReader(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ioutil.ReadAll(r); len(got) != 0 {
+		t.Errorf("empty input: got %q", got)
+	}
+}
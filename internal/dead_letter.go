@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter bulk 写入失败的一条数据，以 NDJSON 格式写入 dead_letter_file
+type DeadLetter struct {
+	ID     string      `json:"id"`
+	Status int         `json:"status"`
+	Error  interface{} `json:"error"`
+	Bulk   string      `json:"bulk"` // 原始的 bulk 请求行：action 行 + source 行
+	Time   string      `json:"time"`
+}
+
+// NewDataItemFromDeadLetter 解析 dead_letter_file 中的一行
+func NewDataItemFromDeadLetter(line string) (*DataItem, error) {
+	var dl *DeadLetter
+	if err := json.Unmarshal([]byte(line), &dl); err != nil {
+		return nil, err
+	}
+	return NewDataItemFromBulk(dl.Bulk)
+}
+
+// DeadLetterWriter 将失败的数据写入文件，可并发调用
+type DeadLetterWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewDeadLetterWriter 以追加的方式打开文件
+func NewDeadLetterWriter(fileName string) (*DeadLetterWriter, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &DeadLetterWriter{file: f}, nil
+}
+
+// Write 写入一条失败的数据，writer 为 nil 时不处理
+func (w *DeadLetterWriter) Write(dl *DeadLetter) error {
+	if w == nil {
+		return nil
+	}
+	dl.Time = time.Now().Format("2006-01-02 15:04:05")
+	bf, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err = w.file.Write(append(bf, '\n'))
+	return err
+}
+
+// Close 关闭文件
+func (w *DeadLetterWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.file.Close()
+}
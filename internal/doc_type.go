@@ -12,7 +12,12 @@ type DocType struct {
 
 // URI 索引的请求路径
 func (d *DocType) URI() string {
-	if d.Type == "" {
+	return d.URIFor(nil)
+}
+
+// URIFor 依据集群支持的功能生成请求路径，集群不支持 _type 时忽略 Type，caps 为 nil 时不检查
+func (d *DocType) URIFor(caps *Capabilities) string {
+	if d.Type == "" || (caps != nil && !caps.Types) {
 		return strings.Join([]string{
 			"/",
 			d.Index,
@@ -48,3 +48,37 @@ func TestDocType_Uri(t *testing.T) {
 		})
 	}
 }
+
+func TestDocType_URIFor(t *testing.T) {
+	d := &DocType{
+		Index: "index",
+		Type:  "type",
+	}
+	tests := []struct {
+		name string
+		caps *Capabilities
+		want string
+	}{
+		{
+			name: "nil",
+			want: "/index/type",
+		},
+		{
+			name: "typed",
+			caps: &Capabilities{Types: true},
+			want: "/index/type",
+		},
+		{
+			name: "typeless",
+			caps: &Capabilities{},
+			want: "/index",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.URIFor(tt.caps); got != tt.want {
+				t.Errorf("URIFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
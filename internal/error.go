@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorCause es 返回的错误信息，es 5.0 之前为字符串，之后为包含 type、reason 等字段的对象
+type ErrorCause struct {
+	Type      string        `json:"type,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+	Index     string        `json:"index,omitempty"`
+	RootCause []*ErrorCause `json:"root_cause,omitempty"`
+	CausedBy  *ErrorCause   `json:"caused_by,omitempty"`
+}
+
+// UnmarshalJSON 兼容字符串和对象两种格式，字符串时作为 Reason
+func (e *ErrorCause) UnmarshalJSON(bs []byte) error {
+	if len(bs) > 0 && bs[0] == '"' {
+		return json.Unmarshal(bs, &e.Reason)
+	}
+	type errorCause ErrorCause
+	return json.Unmarshal(bs, (*errorCause)(e))
+}
+
+func (e *ErrorCause) String() string {
+	if e == nil {
+		return ""
+	}
+	str := e.Reason
+	if e.Type != "" {
+		str = e.Type + ": " + e.Reason
+	}
+	if e.CausedBy != nil {
+		str += " (caused_by " + e.CausedBy.String() + ")"
+	}
+	return str
+}
+
+// EsError 请求 es 返回非 2xx 状态码时的错误
+type EsError struct {
+	// Status http 状态码
+	Status int
+
+	// Type es 的错误类型，如 index_not_found_exception
+	Type string
+
+	Reason    string
+	RootCause []*ErrorCause
+	CausedBy  *ErrorCause
+
+	// Body 原始的响应内容
+	Body string
+}
+
+// newEsError 依据状态码和响应内容创建错误，响应内容不是 json 时只记录原始内容
+func newEsError(status int, body []byte) *EsError {
+	e := &EsError{
+		Status: status,
+		Body:   string(body),
+	}
+	var res ResponseBase
+	if jsonDecode(body, &res) == nil && res.Err != nil {
+		e.Type = res.Err.Type
+		e.Reason = res.Err.Reason
+		e.RootCause = res.Err.RootCause
+		e.CausedBy = res.Err.CausedBy
+	}
+	return e
+}
+
+func (e *EsError) Error() string {
+	if e.Type == "" && e.Reason == "" {
+		return fmt.Sprintf("es error, status=%d, body=%s", e.Status, e.Body)
+	}
+	msg := fmt.Sprintf("es error, status=%d, type=%s, reason=%s", e.Status, e.Type, e.Reason)
+	if len(e.RootCause) > 0 {
+		causes := make([]string, 0, len(e.RootCause))
+		for _, c := range e.RootCause {
+			causes = append(causes, c.String())
+		}
+		msg += ", root_cause=[" + strings.Join(causes, "; ") + "]"
+	}
+	if e.CausedBy != nil {
+		msg += ", caused_by=" + e.CausedBy.String()
+	}
+	return msg
+}
+
+// IsAuth 认证失败或者没有权限
+func (e *EsError) IsAuth() bool {
+	return e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden
+}
+
+// IsNotFound 索引或者数据不存在
+func (e *EsError) IsNotFound() bool {
+	return e.Status == http.StatusNotFound || e.Type == "index_not_found_exception"
+}
+
+// IsConflict 版本冲突
+func (e *EsError) IsConflict() bool {
+	return e.Status == http.StatusConflict || e.Type == "version_conflict_engine_exception"
+}
+
+// IsOverload 集群负载过高，稍后可以重试
+func (e *EsError) IsOverload() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status == http.StatusServiceUnavailable ||
+		e.Type == "es_rejected_execution_exception"
+}
+
+// Temporary 是否为临时性错误，可以重试
+func (e *EsError) Temporary() bool {
+	return e.IsOverload() || e.Status >= 500
+}
+
+// AsEsError 若 err 是 *EsError，返回该值
+func AsEsError(err error) (*EsError, bool) {
+	var e *EsError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// retryable 网络错误等其他错误以及 es 的临时性错误可以重试
+func retryable(err error) bool {
+	if e, ok := AsEsError(err); ok {
+		return e.Temporary()
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestErrorCause_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "es 1.x string",
+			body: `{"error":"IndexMissingException[[test] missing]","status":404}`,
+			want: "IndexMissingException[[test] missing]",
+		},
+		{
+			name: "es 5.x object",
+			body: `{"error":{"type":"index_not_found_exception","reason":"no such index","root_cause":[{"type":"index_not_found_exception","reason":"no such index"}]},"status":404}`,
+			want: "index_not_found_exception: no such index",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res ResponseBase
+			if err := jsonDecode([]byte(tt.body), &res); err != nil {
+				t.Fatalf("jsonDecode() error = %v", err)
+			}
+			if got := res.Err.String(); got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+			if res.Status != 404 {
+				t.Errorf("Status = %v, want 404", res.Status)
+			}
+		})
+	}
+}
+
+func TestEsError(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		body         string
+		wantType     string
+		wantNotFound bool
+		wantOverload bool
+		wantAuth     bool
+		wantConflict bool
+	}{
+		{
+			name:         "index not found",
+			status:       404,
+			body:         `{"error":{"type":"index_not_found_exception","reason":"no such index [test]"},"status":404}`,
+			wantType:     "index_not_found_exception",
+			wantNotFound: true,
+		},
+		{
+			name:         "rejected",
+			status:       429,
+			body:         `{"error":{"type":"es_rejected_execution_exception","reason":"rejected"},"status":429}`,
+			wantType:     "es_rejected_execution_exception",
+			wantOverload: true,
+		},
+		{
+			name:     "auth with html body",
+			status:   401,
+			body:     `<html>Unauthorized</html>`,
+			wantAuth: true,
+		},
+		{
+			name:         "version conflict",
+			status:       409,
+			body:         `{"error":{"type":"version_conflict_engine_exception","reason":"conflict"},"status":409}`,
+			wantType:     "version_conflict_engine_exception",
+			wantConflict: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("wrap: %w", newEsError(tt.status, []byte(tt.body)))
+			e, ok := AsEsError(err)
+			if !ok {
+				t.Fatalf("AsEsError() not ok")
+			}
+			if e.Type != tt.wantType || e.Status != tt.status {
+				t.Errorf("newEsError() = %v", e)
+			}
+			if e.IsNotFound() != tt.wantNotFound || e.IsOverload() != tt.wantOverload ||
+				e.IsAuth() != tt.wantAuth || e.IsConflict() != tt.wantConflict {
+				t.Errorf("classify %v failed", e)
+			}
+			if retryable(err) != tt.wantOverload {
+				t.Errorf("retryable() = %v, want %v", retryable(err), tt.wantOverload)
+			}
+		})
+	}
+}
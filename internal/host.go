@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	// "reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hidu/go-speed"
 )
@@ -25,11 +27,26 @@ type ResponseVersion struct {
 	Tagline     string                 `json:"tagline"`
 }
 
-// Gt 比较版本大小
+// Gt 比较版本大小，集群版本大于 version 时返回 true
 func (vs *ResponseVersion) Gt(version string) bool {
-	number, has := vs.VersionData["number"].(string)
-	if !has {
-		return false
+	c, ok := vs.compare(version)
+	return ok && c > 0
+}
+
+// Gte 集群版本大于或等于 version 时返回 true
+func (vs *ResponseVersion) Gte(version string) bool {
+	c, ok := vs.compare(version)
+	return ok && c >= 0
+}
+
+func (vs *ResponseVersion) compare(version string) (int, bool) {
+	return compareVersion(vs.esNumber(), version)
+}
+
+// compareVersion 比较版本号 number 和 version 的大小
+func compareVersion(number string, version string) (int, bool) {
+	if number == "" {
+		return 0, false
 	}
 	numberArr := strings.Split(number, ".")
 	versionArr := strings.Split(version, ".")
@@ -37,22 +54,25 @@ func (vs *ResponseVersion) Gt(version string) bool {
 	for i, vs := range versionArr {
 		vsI, err0 := strconv.ParseInt(vs, 10, 64)
 		if err0 != nil {
-			return false
+			return 0, false
 		}
 
-		if len(numberArr) < i {
-			return false
+		if len(numberArr) <= i {
+			return 0, false
 		}
 		numI, err1 := strconv.ParseInt(numberArr[i], 10, 64)
 		if err1 != nil {
-			return false
+			return 0, false
 		}
 
 		if vsI != numI {
-			return numI > vsI
+			if numI > vsI {
+				return 1, true
+			}
+			return -1, true
 		}
 	}
-	return false
+	return 0, true
 }
 
 func (vs *ResponseVersion) String() string {
@@ -65,17 +85,45 @@ type Host struct {
 	// Address 主机host信息，eg：http://127.0.0.1:8080
 	Address string `json:"addr"`
 
+	// Addresses 集群的多个节点，请求会轮流发送到各个节点，Address 为空时使用第一个作为 Address
+	Addresses []string `json:"addrs"`
+
+	// DeadTimeout 节点连接失败后不再使用的时间，之后会重新尝试，默认为 60s
+	DeadTimeout string `json:"dead_timeout"`
+
+	// Sniff 初始化时通过 _nodes/http 接口发现集群的其他节点
+	Sniff bool `json:"sniff"`
+
 	// Header http header
 	Header map[string]string `json:"header"`
 
 	// User basic 认证的用户名
 	User string `json:"user"`
 
-	// Password basic 认证的密码
+	// Password basic 认证的密码，支持 ${env:NAME}、${file:/path} 格式
 	Password string `json:"password"`
 
+	// APIKey api key 认证，格式为 id:key 或者 base64 编码后的值，支持 ${env:NAME}、${file:/path} 格式
+	APIKey string `json:"api_key"`
+
+	// BearerToken bearer token 认证，支持 ${env:NAME}、${file:/path} 格式
+	BearerToken string `json:"bearer_token"`
+
+	// TLS https 的配置：CA 证书、客户端证书等
+	TLS *TLSConfig `json:"tls"`
+
+	// AWS Amazon OpenSearch Service 的 SigV4 签名配置，不能和 user、api_key、bearer_token 同时使用
+	AWS *AWSConfig `json:"aws"`
+
+	// Signer 发送请求前对请求签名，为空且配置了 AWS 时使用 SigV4 签名
+	Signer RequestSigner `json:"-"`
+
+	// Transport http 连接的配置：超时、连接池、代理、gzip 压缩
+	Transport *TransportConfig `json:"transport"`
+
 	client *http.Client
 	speed  *speed.Speed
+	pool   *nodePool
 
 	Vs *ResponseVersion `json:"-"`
 }
@@ -85,10 +133,21 @@ func (h *Host) Init() error {
 	if h.speed != nil {
 		return nil
 	}
+	if h.Address == "" && len(h.Addresses) > 0 {
+		h.Address = h.Addresses[0]
+	}
 	u, err := url.Parse(h.Address)
 	if err != nil {
 		return err
 	}
+
+	deadTimeout := 60 * time.Second
+	if h.DeadTimeout != "" {
+		if deadTimeout, err = time.ParseDuration(h.DeadTimeout); err != nil {
+			return fmt.Errorf("invalid dead_timeout %q: %w", h.DeadTimeout, err)
+		}
+	}
+	h.pool = newNodePool(append([]string{h.Address}, h.Addresses...), deadTimeout)
 	if h.User == "" && u.User != nil && u.User.Username() != "" {
 		h.User = u.User.Username()
 		h.Password, _ = u.User.Password()
@@ -97,19 +156,21 @@ func (h *Host) Init() error {
 		h.Header = make(map[string]string)
 	}
 
-	if h.User != "" {
-		ps := fmt.Sprintf("%s:%s", h.User, h.Password)
-		h.Header["Authorization"] = fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(ps)))
+	if err = h.initAuth(); err != nil {
+		return err
 	}
 
 	if _, has := h.Header["User-Agent"]; !has {
 		h.Header["User-Agent"] = "hidu_es-tools"
 	}
 
-	log.Println("Header:", h.Header)
+	log.Println("Header:", maskHeader(h.Header))
 
 	if h.client == nil {
-		h.client = &http.Client{}
+		h.client, err = h.newClient()
+		if err != nil {
+			return err
+		}
 	}
 	h.speed = speed.NewSpeed("es", 5, nil)
 
@@ -120,37 +181,161 @@ func (h *Host) Init() error {
 		return err
 	}
 	log.Println("version_info:", h.Vs)
+	log.Printf("distribution: %s, capabilities: %+v\n", h.Vs.Distribution(), *h.Vs.Capabilities())
 
 	if !h.Vs.Gt("1.0.0") {
-		err = fmt.Errorf("wrong version < 1.0.0")
+		return fmt.Errorf("wrong version < 1.0.0")
+	}
+
+	if h.Sniff {
+		err = h.sniff(u.Scheme)
 	}
 	return err
 }
 
-// DoRequestStream 发送并获取解析结果
-func (h *Host) DoRequestStream(method string, uri string, payload io.Reader, result EsResult) error {
-	h.Init()
+// sniff 通过 _nodes/http 接口获取集群中所有节点的 http 地址，加入到节点列表中
+func (h *Host) sniff(scheme string) error {
+	var res struct {
+		ResponseBase
+		Nodes map[string]struct {
+			HTTP struct {
+				PublishAddress string `json:"publish_address"`
+			} `json:"http"`
+		} `json:"nodes"`
+	}
+	if err := h.DoRequest("GET", "/_nodes/http", "", &res); err != nil {
+		return fmt.Errorf("sniff failed: %w", err)
+	}
+	addrs := make([]string, 0, len(res.Nodes))
+	for _, n := range res.Nodes {
+		addr := n.HTTP.PublishAddress
+		// 格式可能为 hostname/10.0.0.1:9200
+		if i := strings.LastIndex(addr, "/"); i >= 0 {
+			addr = addr[i+1:]
+		}
+		if addr != "" {
+			addrs = append(addrs, scheme+"://"+addr)
+		}
+	}
+	added := h.pool.add(addrs)
+	log.Println("[info] sniff nodes:", addrs, ", added:", added)
+	return nil
+}
 
-	urlStr := strings.Join([]string{h.Address, uri}, "")
-	req, err := http.NewRequest(method, urlStr, payload)
-	if err != nil {
-		return err
+// initAuth 依据 user/password、api_key、bearer_token 设置 Authorization header
+func (h *Host) initAuth() error {
+	n := 0
+	for _, v := range []string{h.User, h.APIKey, h.BearerToken} {
+		if v != "" {
+			n++
+		}
+	}
+	if h.AWS != nil {
+		n++
+	}
+	if n > 1 {
+		return fmt.Errorf("only one of user, api_key, bearer_token, aws can be set")
 	}
 
-	if h.Header != nil {
-		for k, v := range h.Header {
-			req.Header.Set(k, v)
+	var err error
+	if h.AWS != nil && h.Signer == nil {
+		if h.Signer, err = h.AWS.NewSigner(); err != nil {
+			return err
 		}
 	}
+	switch {
+	case h.User != "":
+		if h.Password, err = resolveSecret(h.Password); err != nil {
+			return fmt.Errorf("read password failed: %w", err)
+		}
+		ps := fmt.Sprintf("%s:%s", h.User, h.Password)
+		h.Header["Authorization"] = fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(ps)))
+	case h.APIKey != "":
+		if h.APIKey, err = resolveSecret(h.APIKey); err != nil {
+			return fmt.Errorf("read api_key failed: %w", err)
+		}
+		key := h.APIKey
+		if strings.Contains(key, ":") {
+			key = base64.StdEncoding.EncodeToString([]byte(key))
+		}
+		h.Header["Authorization"] = "ApiKey " + key
+	case h.BearerToken != "":
+		if h.BearerToken, err = resolveSecret(h.BearerToken); err != nil {
+			return fmt.Errorf("read bearer_token failed: %w", err)
+		}
+		h.Header["Authorization"] = "Bearer " + h.BearerToken
+	}
+	return nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// newClient 依据配置创建 http client
+func (h *Host) newClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if h.TLS != nil {
+		cfg, err := h.TLS.Build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = cfg
+	}
+	client := &http.Client{
+		Transport: transport,
+	}
+	if h.Transport != nil {
+		if err := h.Transport.apply(transport); err != nil {
+			return nil, err
+		}
+		timeout, err := h.Transport.timeout()
+		if err != nil {
+			return nil, err
+		}
+		client.Timeout = timeout
+	}
+	return client, nil
+}
 
-	// bf,_:=httputil.DumpRequest(req,true)
-	// log.Println("request=",string(bf))
+// DoRequestStream 发送并获取解析结果，返回非 2xx 状态码时返回 *EsError
+func (h *Host) DoRequestStream(method string, uri string, payload io.Reader, result EsResult) error {
+	h.Init()
 
-	resp, err := h.client.Do(req)
-	if err != nil {
-		return err
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = ioutil.ReadAll(payload); err != nil {
+			return err
+		}
+	}
+	return h.doRequest(method, uri, body, nil, result)
+}
+
+// doRequest 发送请求，header 为本次请求额外的 header
+func (h *Host) doRequest(method string, uri string, body []byte, header map[string]string, result EsResult) error {
+	// 连接失败时标记节点不可用，并尝试下一个节点
+	var resp *http.Response
+	for try := 1; ; try++ {
+		n := h.pool.pick()
+		req, err := h.newRequest(n.addr, method, uri, body)
+		if err != nil {
+			return err
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		if h.Signer != nil {
+			if err = h.Signer.Sign(req, body); err != nil {
+				return err
+			}
+		}
+		resp, err = h.client.Do(req)
+		if err == nil {
+			h.pool.markAlive(n)
+			break
+		}
+		h.pool.markDead(n)
+		if try >= h.pool.size() {
+			return err
+		}
+		log.Printf("[err] request node %s failed, try next node, error=%s\n", n.addr, err)
 	}
 	defer resp.Body.Close()
 	bd, err := ioutil.ReadAll(resp.Body)
@@ -159,10 +344,29 @@ func (h *Host) DoRequestStream(method string, uri string, payload io.Reader, res
 		return err
 	}
 
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newEsError(resp.StatusCode, bd)
+	}
+
 	e := jsonDecode(bd, &result)
 	return e
 }
 
+func (h *Host) newRequest(addr string, method string, uri string, body []byte) (*http.Request, error) {
+	urlStr := strings.Join([]string{addr, uri}, "")
+	req, err := http.NewRequest(method, urlStr, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range h.Header {
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
 // DoRequest 发送请求
 func (h *Host) DoRequest(method string, uri string, payload string, result EsResult) error {
 	return h.DoRequestStream(method, uri, strings.NewReader(payload), result)
@@ -170,7 +374,19 @@ func (h *Host) DoRequest(method string, uri string, payload string, result EsRes
 
 // BulkStream 发送bulk请求
 func (h *Host) BulkStream(stream io.Reader, result *BulkResponse) error {
-	err := h.DoRequestStream("POST", "/_bulk", stream, &result)
+	h.Init()
+	body, err := ioutil.ReadAll(stream)
+	if err != nil {
+		return err
+	}
+	var header map[string]string
+	if h.Transport != nil && h.Transport.Gzip {
+		if body, err = gzipBytes(body); err != nil {
+			return err
+		}
+		header = map[string]string{"Content-Encoding": "gzip"}
+	}
+	err = h.doRequest("POST", "/_bulk", body, header, &result)
 	if err == nil {
 		h.speed.Success("bulk_items", len(result.Items))
 	}
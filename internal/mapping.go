@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// MappingProperties 读取索引的 mapping，返回 _source 中字段的定义(properties)，
+// index 匹配多个索引(或者 es < 7.0 有多个 type)时合并为一个，同名字段的类型不同时使用第一个
+func (h *Host) MappingProperties(index string) (map[string]interface{}, error) {
+	var res map[string]interface{}
+	if err := h.DoRequest("GET", "/"+index+"/_mapping", "", &res); err != nil {
+		return nil, err
+	}
+	props := make(map[string]interface{})
+	for _, v := range res {
+		im, _ := v.(map[string]interface{})
+		mappings, _ := im["mappings"].(map[string]interface{})
+		if ps, ok := mappings["properties"].(map[string]interface{}); ok {
+			mergeProperties(props, ps)
+			continue
+		}
+		// es < 7.0: mappings 下为 type
+		for _, tv := range mappings {
+			tm, _ := tv.(map[string]interface{})
+			if ps, ok := tm["properties"].(map[string]interface{}); ok {
+				mergeProperties(props, ps)
+			}
+		}
+	}
+	if len(props) == 0 {
+		return nil, fmt.Errorf("no properties found in the mapping of %q", index)
+	}
+	return props, nil
+}
+
+func mergeProperties(dst map[string]interface{}, src map[string]interface{}) {
+	for name, v := range src {
+		old, has := dst[name]
+		if !has {
+			dst[name] = v
+			continue
+		}
+		om, _ := old.(map[string]interface{})
+		sm, _ := v.(map[string]interface{})
+		ops, ok1 := om["properties"].(map[string]interface{})
+		sps, ok2 := sm["properties"].(map[string]interface{})
+		if ok1 && ok2 {
+			mergeProperties(ops, sps)
+		}
+	}
+}
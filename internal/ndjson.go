@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadPages 按行读取数据，每行使用 parse 解析为一条数据(空行忽略)，每 size 条组成一页调用 fn，
+// fn 返回 false 时停止读取并返回 false
+func ReadPages(r io.Reader, size int, parse func(line string) (*DataItem, error), fn func(sr *ScrollResponse) bool) (bool, error) {
+	items := make([]*DataItem, 0, size)
+	reader := bufio.NewReader(r)
+	lineNo := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		lineNo++
+		if strings.TrimSpace(line) != "" {
+			item, errItem := parse(line)
+			if errItem != nil {
+				return false, fmt.Errorf("line %d: %w", lineNo, errItem)
+			}
+			items = append(items, item)
+		}
+
+		if len(items) >= size || (err == io.EOF && len(items) > 0) {
+			if !fn(NewScrollResponse(items)) {
+				return false, nil
+			}
+			items = make([]*DataItem, 0, size)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadPages(t *testing.T) {
+	const data = `{"_index":"t","_id":"1","_source":{}}
+{"_index":"t","_id":"2","_source":{}}
+
+{"_index":"t","_id":"3","_source":{}}`
+	tests := []struct {
+		name         string
+		data         string
+		stopAt       int
+		want         []int
+		wantFinished bool
+		wantErr      string
+	}{
+		{name: "all", data: data, want: []int{2, 1}, wantFinished: true},
+		{name: "stop", data: data, stopAt: 1, want: []int{2}},
+		{name: "empty", data: "", wantFinished: true},
+		{name: "invalid", data: data + "\n{\"_id\":\"4\"}\n", want: []int{2}, wantErr: "line 5:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			finished, err := ReadPages(strings.NewReader(tt.data), 2, NewDataItem, func(sr *ScrollResponse) bool {
+				got = append(got, len(sr.Hits.Hits))
+				return len(got) != tt.stopAt
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want prefix %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if finished != tt.wantFinished {
+				t.Errorf("finished = %v, want %v", finished, tt.wantFinished)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("pages = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("pages = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// node 集群中的一个节点
+type node struct {
+	addr      string
+	deadUntil time.Time // 在此之前不会被选中
+	fails     int
+}
+
+// nodePool 多个节点轮流使用，连接失败的节点会在 deadTimeout 内不再使用，之后重新尝试
+type nodePool struct {
+	mu          sync.Mutex
+	nodes       []*node
+	next        int
+	deadTimeout time.Duration
+}
+
+func newNodePool(addrs []string, deadTimeout time.Duration) *nodePool {
+	p := &nodePool{
+		deadTimeout: deadTimeout,
+	}
+	p.add(addrs)
+	return p
+}
+
+// add 添加节点，已存在的节点会忽略，返回新增的节点数
+func (p *nodePool) add(addrs []string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, addr := range addrs {
+		addr = strings.TrimRight(strings.TrimSpace(addr), "/")
+		if addr == "" || p.find(addr) != nil {
+			continue
+		}
+		p.nodes = append(p.nodes, &node{addr: addr})
+		n++
+	}
+	return n
+}
+
+func (p *nodePool) find(addr string) *node {
+	for _, n := range p.nodes {
+		if n.addr == addr {
+			return n
+		}
+	}
+	return nil
+}
+
+// size 节点总数
+func (p *nodePool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.nodes)
+}
+
+// pick 轮流选择一个可用的节点，所有节点都不可用时，选择最早恢复的节点
+func (p *nodePool) pick() *node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var earliest *node
+	for i := 0; i < len(p.nodes); i++ {
+		n := p.nodes[(p.next+i)%len(p.nodes)]
+		if !now.Before(n.deadUntil) {
+			p.next = (p.next + i + 1) % len(p.nodes)
+			return n
+		}
+		if earliest == nil || n.deadUntil.Before(earliest.deadUntil) {
+			earliest = n
+		}
+	}
+	return earliest
+}
+
+// markDead 节点连接失败，连续失败时不可用的时间会变长，最长为 deadTimeout 的 32 倍
+func (p *nodePool) markDead(n *node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n.fails < 5 {
+		n.fails++
+	}
+	n.deadUntil = time.Now().Add(p.deadTimeout * time.Duration(1<<uint(n.fails-1)))
+}
+
+// markAlive 节点请求成功
+func (p *nodePool) markAlive(n *node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n.fails = 0
+	n.deadUntil = time.Time{}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNodePool(t *testing.T) {
+	p := newNodePool([]string{"http://a:9200/", "http://b:9200", "http://a:9200"}, time.Minute)
+	if p.size() != 2 {
+		t.Fatalf("size() = %d, want 2", p.size())
+	}
+
+	tests := []struct {
+		name string
+		dead string
+		want []string
+	}{
+		{name: "round robin", want: []string{"http://a:9200", "http://b:9200", "http://a:9200"}},
+		{name: "b dead", dead: "http://b:9200", want: []string{"http://a:9200", "http://a:9200"}},
+		{name: "all dead", dead: "http://a:9200", want: []string{"http://b:9200"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.dead != "" {
+				p.markDead(p.find(tt.dead))
+			}
+			for i, want := range tt.want {
+				if got := p.pick().addr; got != want {
+					t.Errorf("pick() %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+
+	p.markAlive(p.find("http://a:9200"))
+	if got := p.pick().addr; got != "http://a:9200" {
+		t.Errorf("pick() after markAlive = %v", got)
+	}
+	if n := p.add([]string{"http://c:9200", "http://b:9200"}); n != 1 {
+		t.Errorf("add() = %d, want 1", n)
+	}
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// bulk 的操作类型
+const (
+	// OpIndex 写入数据，已存在时覆盖
+	OpIndex = "index"
+
+	// OpCreate 写入数据，已存在时返回 409，不覆盖
+	OpCreate = "create"
+
+	// OpUpdate 使用 _source 作为 doc 更新部分字段，或者使用脚本更新
+	OpUpdate = "update"
+
+	// OpDelete 删除数据
+	OpDelete = "delete"
+)
+
+// CheckOpType 检查 op_type 配置是否正确，允许为空
+func CheckOpType(op string) error {
+	switch op {
+	case "", OpIndex, OpCreate, OpUpdate, OpDelete:
+		return nil
+	}
+	return fmt.Errorf("unknown op_type %q, should be one of: index, create, update, delete", op)
+}
+
+// Op bulk 的操作类型，OpType 为空时为 index
+func (item *DataItem) Op() string {
+	if item.OpType == "" {
+		return OpIndex
+	}
+	return item.OpType
+}
+
+// bulkBody bulk 请求中 action 行之后的数据，delete 时没有
+func (item *DataItem) bulkBody() interface{} {
+	switch item.Op() {
+	case OpDelete:
+		return nil
+	case OpUpdate:
+		body := make(map[string]interface{})
+		if item.Script != nil {
+			body["script"] = item.Script
+			if item.DocAsUpsert {
+				body["upsert"] = item.Source
+			}
+		} else {
+			body["doc"] = item.Source
+			if item.DocAsUpsert {
+				body["doc_as_upsert"] = true
+			}
+		}
+		return body
+	}
+	return item.Source
+}
+
+// bulkUpdateBody update 操作的数据
+type bulkUpdateBody struct {
+	Doc         map[string]interface{} `json:"doc"`
+	DocAsUpsert bool                   `json:"doc_as_upsert"`
+	Script      map[string]interface{} `json:"script"`
+	Upsert      map[string]interface{} `json:"upsert"`
+}
+
+// setBulkBody 解析 bulk 请求中 action 行之后的数据
+func (item *DataItem) setBulkBody(line string) error {
+	if item.Op() != OpUpdate {
+		return jsonDecode([]byte(line), &item.Source)
+	}
+	var body bulkUpdateBody
+	if err := jsonDecode([]byte(line), &body); err != nil {
+		return err
+	}
+	if body.Script != nil {
+		item.Script = body.Script
+		item.Source = body.Upsert
+		item.DocAsUpsert = body.Upsert != nil
+		return nil
+	}
+	item.Source = body.Doc
+	item.DocAsUpsert = body.DocAsUpsert
+	return nil
+}
+
+// SetOp 设置数据的操作类型，数据中已有的 OpType(data_fix_cmd 返回的 _op_type)优先，为空时使用 op。
+// 操作类型为 update 时，docAsUpsert 为 true 则设置 DocAsUpsert，
+// 数据没有 Script 时使用 script，script 的 params.doc 为数据的 _source
+func (item *DataItem) SetOp(op string, docAsUpsert bool, script map[string]interface{}) error {
+	if item.OpType == "" && op != OpIndex {
+		item.OpType = op
+	}
+	if err := CheckOpType(item.OpType); err != nil {
+		return err
+	}
+	if item.Op() != OpUpdate {
+		return nil
+	}
+	if docAsUpsert {
+		item.DocAsUpsert = true
+	}
+	if item.Script == nil && script != nil {
+		sc := make(map[string]interface{}, len(script)+1)
+		for k, v := range script {
+			sc[k] = v
+		}
+		params := make(map[string]interface{})
+		if ps, ok := script["params"].(map[string]interface{}); ok {
+			for k, v := range ps {
+				params[k] = v
+			}
+		}
+		params["doc"] = item.Source
+		sc["params"] = params
+		item.Script = sc
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// PointInTime 使用 point in time + search_after 分页读取数据，用于替代 scroll 进行深度分页
+// https://www.elastic.co/guide/en/elasticsearch/reference/7.12/paginate-search-results.html#search-after
+type PointInTime struct {
+	host   *Host
+	doc    *DocType
+	query  *Query
+	second int
+	loopNo uint64
+	total  uint64
+	pos    uint64
+
+	withCheckpoint
+	searchAfter []interface{}
+
+	slice *sliceInfo
+
+	mu       sync.Mutex // 保护 pitID，Close 可能在其他 goroutine 中调用
+	pitID    string
+	closed   bool
+	finished bool // 已读取完成
+}
+
+// NewPointInTime 创建一个 point in time 读取
+func NewPointInTime(host *Host, doc *DocType, query *Query) *PointInTime {
+	return &PointInTime{
+		host:   host,
+		doc:    doc,
+		query:  query,
+		second: 120,
+	}
+}
+
+// SetScanTime 设置 point in time 的有效期，每次查询都会续期
+func (p *PointInTime) SetScanTime(sec int) {
+	p.second = sec
+}
+
+// SetSlice 设置分片，id 从 0 开始
+func (p *PointInTime) SetSlice(id int, max int) {
+	p.slice = &sliceInfo{
+		ID:  id,
+		Max: max,
+	}
+}
+
+func (p *PointInTime) keepAlive() string {
+	return fmt.Sprintf("%ds", p.second)
+}
+
+// EnableCheckpoint 开启断点续传，定期将已确认(Ack)的进度写入 fileName，
+// resume 为 true 时使用断点中的 point in time 继续读取，所以需要在 point in time 过期前续传
+func (p *PointInTime) EnableCheckpoint(fileName string, resume bool) error {
+	if p.slice != nil {
+		return fmt.Errorf("checkpoint can not be used with sliced point in time")
+	}
+	p.cp = newCheckpointer(fileName, p.query)
+	if !resume {
+		return nil
+	}
+	cp, err := p.cp.load()
+	if err != nil {
+		return err
+	}
+	if cp.PitID == "" {
+		return fmt.Errorf("checkpoint %q has no pit_id", fileName)
+	}
+	p.pitID = cp.PitID
+	p.searchAfter = cp.SearchAfter
+	p.pos = cp.Pos
+	p.loopNo = cp.LoopNo
+	p.total = cp.Total
+	log.Printf("[info] resume from checkpoint %q, loopNo=%d, total=%d, pos=%d\n", fileName, p.loopNo, p.total, p.pos)
+	return nil
+}
+
+func (p *PointInTime) open() error {
+	var res struct {
+		ResponseBase
+		ID string `json:"id"`
+	}
+	uri := "/" + p.doc.Index + "/_pit?keep_alive=" + p.keepAlive()
+	err := p.host.DoRequest("POST", uri, "", &res)
+	log.Println("[info] open point in time, error=", err, ", uri=", uri)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		return res.Error()
+	}
+	if res.ID == "" {
+		return fmt.Errorf("open point in time failed, resp has no id")
+	}
+	p.mu.Lock()
+	p.pitID = res.ID
+	p.mu.Unlock()
+	return nil
+}
+
+// Close 关闭 point in time，释放集群上的资源，读取完成后会自动调用。
+// 开启断点续传且未读取完成时不关闭，断点中的 point in time 在 keep_alive 后过期，之前可以续传
+func (p *PointInTime) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.pitID == "" {
+		return nil
+	}
+	if p.cp != nil && !p.finished {
+		log.Println("[info] keep point in time for resume, expires after", p.keepAlive())
+		p.pitID = ""
+		return nil
+	}
+	bf, _ := json.Marshal(map[string]string{"id": p.pitID})
+	var res ResponseBase
+	err := p.host.DoRequest("DELETE", "/_pit", string(bf), &res)
+	if err == nil && res.IsError() {
+		err = res.Error()
+	}
+	log.Println("[info] close point in time, error=", err)
+	p.pitID = ""
+	return err
+}
+
+// Next 获取下一页数据，读取完成后会自动关闭 point in time
+func (p *PointInTime) Next() (*ScrollResponse, error) {
+	p.mu.Lock()
+	pitID, closed := p.pitID, p.closed
+	p.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("point in time is closed")
+	}
+	if pitID == "" {
+		if err := p.open(); err != nil {
+			return nil, err
+		}
+	}
+
+	body := newSearchBody(p.query, p.slice)
+	p.mu.Lock()
+	body["pit"] = map[string]string{
+		"id":         p.pitID,
+		"keep_alive": p.keepAlive(),
+	}
+	p.mu.Unlock()
+	if _, has := body["sort"]; !has {
+		body["sort"] = []interface{}{
+			map[string]string{"_shard_doc": "asc"},
+		}
+	}
+	if len(p.searchAfter) > 0 {
+		body["search_after"] = p.searchAfter
+	}
+	if _, has := body["track_total_hits"]; !has && p.total == 0 {
+		body["track_total_hits"] = true
+	}
+
+	// 使用 point in time 时，请求路径中不能带索引
+	srt, err := searchRetry(p.host, "/_search", body.String())
+	if err != nil {
+		// 开启断点续传时保留 point in time，见 Close
+		p.Close()
+		return nil, err
+	}
+	p.mu.Lock()
+	if srt.PitID != "" {
+		p.pitID = srt.PitID
+	}
+	pitID = p.pitID
+	p.mu.Unlock()
+
+	p.loopNo++
+	srt.seq = p.loopNo
+	if p.slice != nil {
+		srt.slice = p.slice.ID
+	}
+
+	if srt.HasMore() {
+		hits := srt.Hits.Hits
+		p.searchAfter = srt.lastSort()
+		p.pos += uint64(len(hits))
+	}
+	if p.total == 0 && srt.Hits != nil {
+		p.total = uint64(srt.Hits.Total)
+	}
+	if p.cp != nil {
+		p.cp.read(srt.seq, &pageMark{searchAfter: p.searchAfter, pos: p.pos, pitID: pitID}, p.total)
+	}
+
+	p.host.speed.Success("scroll_next", 1)
+	if srt.Hits != nil {
+		p.host.speed.Success("scroll_result_items", len(srt.Hits.Hits))
+	}
+
+	log.Printf("[info] pit_next result, slice=%d, loopNo=%d, total=%d, pos=%d\n", srt.slice, p.loopNo, p.total, p.pos)
+
+	if !srt.HasMore() {
+		p.mu.Lock()
+		p.finished = true
+		p.mu.Unlock()
+		p.Close()
+	}
+	return srt, nil
+}
+
+// Total 匹配的数据总条数
+func (p *PointInTime) Total() uint64 {
+	return p.total
+}
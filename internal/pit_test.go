@@ -0,0 +1,168 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestPointInTime_Next(t *testing.T) {
+	es, host := newStubES(t, "7.17.0", 25)
+	p := NewPointInTime(host, &DocType{Index: "test"}, &Query{"size": 10})
+
+	var ids []string
+	for {
+		sr, err := p.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sr.HasMore() {
+			break
+		}
+		for _, item := range sr.Hits.Hits {
+			ids = append(ids, item.ID)
+		}
+	}
+	if len(ids) != 25 || ids[0] != "0-0" || ids[24] != "0-24" {
+		t.Errorf("ids = %v", ids)
+	}
+	if p.Total() != 25 {
+		t.Errorf("Total() = %d, want 25", p.Total())
+	}
+	if n := es.count("POST /test/_pit"); n != 1 {
+		t.Errorf("open pit %d times, want 1", n)
+	}
+
+	// 每次请求使用上一次响应中的 pit_id，search_after 为上一页最后一条的排序值
+	wantAfter := []string{"[]", "[9]", "[19]", "[24]"}
+	if len(es.searches) != len(wantAfter) {
+		t.Fatalf("searches = %+v", es.searches)
+	}
+	for i, s := range es.searches {
+		if want := fmt.Sprintf("pit-%d", i); s.PitID != want {
+			t.Errorf("search %d pit id = %q, want %q", i, s.PitID, want)
+		}
+		if got := fmt.Sprint(s.SearchAfter); got != wantAfter[i] {
+			t.Errorf("search %d search_after = %s, want %s", i, got, wantAfter[i])
+		}
+	}
+
+	if _, err := p.Next(); err == nil {
+		t.Error("Next() after finished should fail")
+	}
+}
+
+func TestPointInTime_EnableCheckpoint(t *testing.T) {
+	es, host := newStubES(t, "7.17.0", 25)
+	fileName := filepath.Join(testTempDir(t), "checkpoint.json")
+	p := NewPointInTime(host, &DocType{Index: "test"}, &Query{"size": 10})
+	if err := p.EnableCheckpoint(fileName, false); err != nil {
+		t.Fatal(err)
+	}
+	sr, err := p.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Ack(sr); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.SaveCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	// 中断：未读取完成时不关闭断点中的 point in time
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := es.count("DELETE /_pit"); n != 0 {
+		t.Fatalf("DELETE /_pit %d times before resume, want 0", n)
+	}
+
+	// 从断点继续：使用断点中的 pit_id 和 search_after，不重新打开
+	p2 := NewPointInTime(host, &DocType{Index: "test"}, &Query{"size": 10})
+	if err = p2.EnableCheckpoint(fileName, true); err != nil {
+		t.Fatal(err)
+	}
+	sr, err = p2.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sr.Hits.Hits) != 10 || sr.Hits.Hits[0].ID != "0-10" {
+		t.Errorf("first page after resume = %s", sr)
+	}
+	last := es.searches[len(es.searches)-1]
+	if last.PitID != "pit-1" || fmt.Sprint(last.SearchAfter) != "[9]" {
+		t.Errorf("resume search = %+v", last)
+	}
+	if n := es.count("POST /test/_pit"); n != 1 {
+		t.Errorf("open pit %d times, want 1", n)
+	}
+	for sr.HasMore() {
+		if sr, err = p2.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 读取完成后关闭
+	if n := es.count("DELETE /_pit"); n != 1 {
+		t.Errorf("DELETE /_pit %d times after finished, want 1", n)
+	}
+}
+
+func TestPointInTime_Close(t *testing.T) {
+	tests := []struct {
+		name       string
+		pages      int  // Close 前读取的页数，3 时已读取完成并自动关闭
+		checkpoint bool // 开启断点续传
+		fail       bool // 读取 pages 页后查询出错
+		want       int  // DELETE /_pit 的次数
+	}{
+		{name: "not started", pages: 0},
+		{name: "reading", pages: 1, want: 1},
+		{name: "finished", pages: 3, want: 1},
+		{name: "failed", pages: 1, fail: true, want: 1},
+		{name: "checkpoint reading", pages: 1, checkpoint: true},
+		{name: "checkpoint failed", pages: 1, checkpoint: true, fail: true},
+		{name: "checkpoint finished", pages: 3, checkpoint: true, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, host := newStubES(t, "7.17.0", 15)
+			p := NewPointInTime(host, &DocType{Index: "test"}, &Query{"size": 10})
+			if tt.checkpoint {
+				if err := p.EnableCheckpoint(filepath.Join(testTempDir(t), "checkpoint.json"), false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < tt.pages; i++ {
+				if _, err := p.Next(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.fail {
+				es.mu.Lock()
+				es.failSlice = 0
+				es.mu.Unlock()
+				if _, err := p.Next(); err == nil {
+					t.Fatal("Next() should fail")
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if err := p.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := es.count("DELETE /_pit"); n != tt.want {
+				t.Errorf("DELETE /_pit %d times, want %d", n, tt.want)
+			}
+			// 关闭最后一次响应中的 pit_id
+			if wantBody := fmt.Sprintf(`{"id":"pit-%d"}`, tt.pages); tt.want > 0 && es.deletes[0] != wantBody {
+				t.Errorf("DELETE /_pit body = %s, want %s", es.deletes[0], wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// Reader 分页读取索引中的数据，scroll 和 point in time 都实现了该接口
+type Reader interface {
+	// Next 获取下一页数据，没有更多数据时返回的结果 HasMore() 为 false
+	Next() (*ScrollResponse, error)
+
+	// Total 匹配的数据总条数
+	Total() uint64
+
+	// EnableCheckpoint 开启断点续传
+	EnableCheckpoint(fileName string, resume bool) error
+
+	// Checkpoint 当前的断点信息，未开启断点续传时返回 nil
+	Checkpoint() *Checkpoint
+
+	// SetCheckpointCounters 设置保存断点时需要一起保存的计数器
+	SetCheckpointCounters(fn func() map[string]uint64)
+
+	// Ack 确认一页数据已处理完成
+	Ack(sr *ScrollResponse) error
+
+	// SaveCheckpoint 立即保存断点
+	SaveCheckpoint() error
+
+	// Close 释放集群上的 scroll 上下文或 point in time，可以多次调用
+	Close() error
+}
+
+// 读取数据的方式
+const (
+	ReaderAuto   = "auto"
+	ReaderScroll = "scroll"
+	ReaderPIT    = "pit"
+)
+
+// ReaderOption 创建 Reader 的参数
+type ReaderOption struct {
+	// Kind 读取方式，auto 时 es 7.12 及之后的版本使用 point in time，其他使用 scroll
+	Kind string
+
+	// Slices 并行读取的分片数，<= 1 时不分片
+	Slices int
+
+	// ScanTime scroll 和 point in time 的有效期，单位秒，<= 0 时使用默认值
+	ScanTime int
+}
+
+// NewReaders 创建读取数据的 Reader，开启分片时返回多个，可以使用 ReadSlices 并行读取
+func NewReaders(host *Host, doc *DocType, query *Query, opt *ReaderOption) ([]Reader, error) {
+	caps := host.Vs.Capabilities()
+	kind := opt.Kind
+	switch kind {
+	case "", ReaderAuto:
+		// _shard_doc 排序在 7.12 才支持
+		if caps.PIT {
+			kind = ReaderPIT
+		} else {
+			kind = ReaderScroll
+		}
+	case ReaderScroll:
+	case ReaderPIT:
+		if !caps.PIT {
+			return nil, fmt.Errorf("point in time requires elasticsearch version >= 7.12.0")
+		}
+	default:
+		return nil, fmt.Errorf("unknown reader kind %q", kind)
+	}
+
+	max := opt.Slices
+	if max < 1 {
+		max = 1
+	}
+	if max > 1 && !caps.Slice {
+		return nil, fmt.Errorf("sliced scroll requires es version >= 5.0.0")
+	}
+
+	readers := make([]Reader, 0, max)
+	for i := 0; i < max; i++ {
+		if kind == ReaderPIT {
+			p := NewPointInTime(host, doc, query)
+			if max > 1 {
+				p.SetSlice(i, max)
+			}
+			if opt.ScanTime > 0 {
+				p.SetScanTime(opt.ScanTime)
+			}
+			readers = append(readers, p)
+			continue
+		}
+		s := NewScroll(host, doc, query)
+		if max > 1 {
+			s.SetSlice(i, max)
+		}
+		if opt.ScanTime > 0 {
+			s.SetScanTime(opt.ScanTime)
+		}
+		readers = append(readers, s)
+	}
+	return readers, nil
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubES 模拟 es 的 scroll、search_after、point in time 接口，
+// 索引为 test，每个 slice 有 docs 条数据，排序值为数据的序号
+type stubES struct {
+	version   string
+	docs      int
+	failSlice int // 该 slice 的查询返回 400，< 0 时不出错
+
+	mu       sync.Mutex
+	requests []string // METHOD path
+	searches []stubSearch
+	deletes  []string // DELETE 请求的 body
+	pitNo    int
+	closed   map[string]bool // 已关闭的 pit id
+}
+
+// stubSearch 一次 _search 请求的参数
+type stubSearch struct {
+	PitID       string
+	SearchAfter []interface{}
+	Slice       int
+}
+
+func newStubES(t *testing.T, version string, docs int) (*stubES, *Host) {
+	es := &stubES{
+		version:   version,
+		docs:      docs,
+		failSlice: -1,
+		closed:    make(map[string]bool),
+	}
+	ts := httptest.NewServer(es)
+	t.Cleanup(ts.Close)
+	host := &Host{Address: ts.URL}
+	if err := host.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return es, host
+}
+
+// testTempDir 创建临时目录，测试结束后删除
+func testTempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "es_tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+// count 收到的 METHOD path 请求次数
+func (es *stubES) count(req string) int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	n := 0
+	for _, r := range es.requests {
+		if r == req {
+			n++
+		}
+	}
+	return n
+}
+
+func (es *stubES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bs, _ := ioutil.ReadAll(r.Body)
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.requests = append(es.requests, r.Method+" "+r.URL.Path)
+
+	var body struct {
+		Size        int               `json:"size"`
+		Slice       *sliceInfo        `json:"slice"`
+		SearchAfter []interface{}     `json:"search_after"`
+		Pit         map[string]string `json:"pit"`
+		ScrollID    string            `json:"scroll_id"`
+	}
+	if len(bs) > 0 {
+		json.Unmarshal(bs, &body)
+	}
+	if body.Size == 0 {
+		body.Size = 10
+	}
+	slice := 0
+	if body.Slice != nil {
+		slice = body.Slice.ID
+	}
+
+	switch {
+	case r.URL.Path == "/":
+		fmt.Fprintf(w, `{"version":{"number":%q}}`, es.version)
+	case r.URL.Path == "/test/_pit":
+		fmt.Fprintf(w, `{"id":"pit-%d"}`, es.pitNo)
+	case r.Method == http.MethodDelete:
+		es.deletes = append(es.deletes, string(bs))
+		if r.URL.Path == "/_pit" {
+			var pit map[string]string
+			json.Unmarshal(bs, &pit)
+			es.closed[pit["id"]] = true
+		}
+		w.Write([]byte(`{"succeeded":true}`))
+	case r.URL.Path == "/_search/scroll":
+		// scroll_id 为 slice:offset
+		parts := strings.SplitN(body.ScrollID, ":", 3)
+		slice, _ = strconv.Atoi(parts[0])
+		offset, _ := strconv.Atoi(parts[1])
+		size, _ := strconv.Atoi(parts[2])
+		es.writePage(w, slice, offset, size, "")
+	case r.URL.Path == "/test/_search" && r.URL.Query().Get("scroll") != "":
+		es.writePage(w, slice, 0, body.Size, "")
+	case r.URL.Path == "/test/_search" || r.URL.Path == "/_search":
+		es.searches = append(es.searches, stubSearch{PitID: body.Pit["id"], SearchAfter: body.SearchAfter, Slice: slice})
+		if body.Pit != nil && es.closed[body.Pit["id"]] {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"type":"search_context_missing_exception","reason":"No search context found"},"status":404}`))
+			return
+		}
+		offset := 0
+		if len(body.SearchAfter) > 0 {
+			n, _ := strconv.Atoi(fmt.Sprint(body.SearchAfter[0]))
+			offset = n + 1
+		}
+		pitID := ""
+		if body.Pit != nil {
+			es.pitNo++
+			pitID = fmt.Sprintf("pit-%d", es.pitNo)
+		}
+		es.writePage(w, slice, offset, body.Size, pitID)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// writePage 输出 slice 中从 offset 开始的一页数据，需要持有锁
+func (es *stubES) writePage(w http.ResponseWriter, slice int, offset int, size int, pitID string) {
+	if slice == es.failSlice {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"type":"illegal_argument_exception","reason":"stub"},"status":400}`))
+		return
+	}
+	hits := []string{}
+	for i := offset; i < es.docs && i < offset+size; i++ {
+		hits = append(hits, fmt.Sprintf(`{"_index":"test","_id":"%d-%d","_source":{"n":%d},"sort":[%d]}`, slice, i, i, i))
+	}
+	res := map[string]interface{}{
+		"_scroll_id": fmt.Sprintf("%d:%d:%d", slice, offset+len(hits), size),
+		"hits":       json.RawMessage(fmt.Sprintf(`{"total":{"value":%d},"hits":[%s]}`, es.docs, strings.Join(hits, ","))),
+	}
+	if pitID != "" {
+		res["pit_id"] = pitID
+	}
+	bs, _ := json.Marshal(res)
+	w.Write(bs)
+}
+
+func TestNewReaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		kind    string
+		slices  int
+		want    string
+		wantErr bool
+	}{
+		{name: "auto pit", version: "7.12.0", kind: ReaderAuto, want: "*internal.PointInTime"},
+		{name: "auto 8.x", version: "8.1.0", want: "*internal.PointInTime"},
+		{name: "auto fallback to scroll", version: "7.11.2", kind: ReaderAuto, want: "*internal.Scroll"},
+		{name: "auto 6.x", version: "6.8.0", slices: 2, want: "*internal.Scroll"},
+		{name: "scroll on 8.x", version: "8.1.0", kind: ReaderScroll, want: "*internal.Scroll"},
+		{name: "pit below 7.12", version: "7.11.2", kind: ReaderPIT, wantErr: true},
+		{name: "slices on 2.x", version: "2.4.0", slices: 2, wantErr: true},
+		{name: "unknown kind", version: "7.12.0", kind: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, host := newStubES(t, tt.version, 0)
+			readers, err := NewReaders(host, &DocType{Index: "test"}, NewQuery(), &ReaderOption{Kind: tt.kind, Slices: tt.slices})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewReaders() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			wantNum := tt.slices
+			if wantNum < 1 {
+				wantNum = 1
+			}
+			if len(readers) != wantNum {
+				t.Fatalf("len(readers) = %d, want %d", len(readers), wantNum)
+			}
+			if got := fmt.Sprintf("%T", readers[0]); got != tt.want {
+				t.Errorf("reader = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package internal
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"strings"
 )
@@ -15,18 +14,28 @@ type EsResult interface {
 
 // ResponseBase 所有response的基类
 type ResponseBase struct {
-	ErrorStr string `json:"error"`
-	Raw      string `json:"-"` // 原始的resp
+	Err    *ErrorCause `json:"error"`
+	Status int         `json:"status,omitempty"`
+	Raw    string      `json:"-"` // 原始的resp
 }
 
 // IsError 是否有错
 func (e *ResponseBase) IsError() bool {
-	return e.ErrorStr != ""
+	return e.Err != nil
 }
 
 // Error 返回错误
 func (e *ResponseBase) Error() error {
-	return errors.New(e.ErrorStr)
+	if e.Err == nil {
+		return nil
+	}
+	return &EsError{
+		Status:    e.Status,
+		Type:      e.Err.Type,
+		Reason:    e.Err.Reason,
+		RootCause: e.Err.RootCause,
+		CausedBy:  e.Err.CausedBy,
+	}
 }
 
 // RawResp 原始的response内容
@@ -41,7 +50,7 @@ type ScanResponse struct {
 	Token    int    `json:"took"`
 	TimedOut bool   `json:"timed_out"`
 	Hits     struct {
-		Total uint64 `json:"total"`
+		Total HitsTotal `json:"total"`
 	}
 }
 
@@ -53,13 +62,92 @@ func (sr *ScanResponse) String() string {
 // ScrollResponse scroll的返回结果
 type ScrollResponse struct {
 	ResponseBase
-	ScrollID string `json:"_scroll_id"`
-	Token    int    `json:"took"`
-	TimedOut bool   `json:"timed_out"`
-	Hits     *struct {
-		Total uint64      `json:"total"`
-		Hits  []*DataItem `json:"hits"`
-	} `json:"hits"`
+	ScrollID string      `json:"_scroll_id"`
+	PitID    string      `json:"pit_id,omitempty"`
+	Token    int         `json:"took"`
+	TimedOut bool        `json:"timed_out"`
+	Hits     *ScrollHits `json:"hits"`
+
+	seq   uint64 // 页序号，用于断点确认
+	slice int    // 所属的 slice
+}
+
+// ScrollHits 一页的数据
+type ScrollHits struct {
+	Total HitsTotal   `json:"total"`
+	Hits  []*DataItem `json:"hits"`
+
+	lastSort []interface{} // 最后一条数据的排序值，用于 search_after
+}
+
+// UnmarshalJSON 解析数据，排序值(sort)只记录最后一条的，不放入 DataItem
+func (h *ScrollHits) UnmarshalJSON(bs []byte) error {
+	var raw struct {
+		Total HitsTotal `json:"total"`
+		Hits  []struct {
+			*DataItem
+			Sort []interface{} `json:"sort"`
+		} `json:"hits"`
+	}
+	if err := jsonDecode(bs, &raw); err != nil {
+		return err
+	}
+	h.Total = raw.Total
+	h.Hits = make([]*DataItem, 0, len(raw.Hits))
+	for _, hit := range raw.Hits {
+		if hit.DataItem == nil {
+			hit.DataItem = &DataItem{}
+		}
+		h.Hits = append(h.Hits, hit.DataItem)
+		h.lastSort = hit.Sort
+	}
+	return nil
+}
+
+// Slice 数据所属 sliced scroll 的分片 id
+func (sr *ScrollResponse) Slice() int {
+	return sr.slice
+}
+
+// lastSort 最后一条数据的排序值
+func (sr *ScrollResponse) lastSort() []interface{} {
+	if sr.Hits == nil {
+		return nil
+	}
+	return sr.Hits.lastSort
+}
+
+// NewScrollResponse 使用已有的数据创建一页结果，用于从文件等来源读取数据
+func NewScrollResponse(items []*DataItem) *ScrollResponse {
+	return &ScrollResponse{
+		Hits: &ScrollHits{
+			Total: HitsTotal(len(items)),
+			Hits:  items,
+		},
+	}
+}
+
+// HitsTotal 匹配的总数，es 7.0 之后格式为 {"value":100,"relation":"eq"}
+type HitsTotal uint64
+
+// UnmarshalJSON 兼容数字和对象两种格式
+func (t *HitsTotal) UnmarshalJSON(bs []byte) error {
+	if len(bs) > 0 && bs[0] == '{' {
+		var obj struct {
+			Value uint64 `json:"value"`
+		}
+		if err := json.Unmarshal(bs, &obj); err != nil {
+			return err
+		}
+		*t = HitsTotal(obj.Value)
+		return nil
+	}
+	var n uint64
+	if err := json.Unmarshal(bs, &n); err != nil {
+		return err
+	}
+	*t = HitsTotal(n)
+	return nil
 }
 
 // HasMore 是否有更多
@@ -72,7 +160,7 @@ func (sr *ScrollResponse) String() string {
 	return string(bf)
 }
 
-// NewDataItem 创建一条结果数据
+// NewDataItem 创建一条结果数据，_type 可以为空，_op_type 为 delete 时 _source 可以为空
 func NewDataItem(str string) (*DataItem, error) {
 	var item *DataItem
 	dec := json.NewDecoder(strings.NewReader(str))
@@ -82,22 +170,114 @@ func NewDataItem(str string) (*DataItem, error) {
 	if err != nil {
 		return nil, err
 	}
-	if item.Index == "" || item.Type == "" || item.ID == "" {
-		return nil, fmt.Errorf("_index, _type, _id is empty, input=%q", str)
+	if item.Index == "" || item.ID == "" {
+		return nil, fmt.Errorf("_index, _id is empty, input=%q", str)
 	}
 
-	if item.Source == nil {
+	if err = CheckOpType(item.OpType); err != nil {
+		return nil, err
+	}
+
+	if item.Source == nil && item.Op() != OpDelete && item.Script == nil {
 		return nil, fmt.Errorf("_source is empty, input=%q", str)
 	}
 
 	return item, err
 }
 
+// NewDataItemFromBulk 解析 BulkString 输出的 bulk 请求行（action 行 + source 行）
+func NewDataItemFromBulk(str string) (*DataItem, error) {
+	lines := strings.SplitN(strings.TrimSpace(str), "\n", 2)
+	var header map[string]*bulkMeta
+	if err := jsonDecode([]byte(lines[0]), &header); err != nil {
+		return nil, err
+	}
+	var item *DataItem
+	for op, meta := range header {
+		if meta != nil {
+			item = meta.dataItem()
+			if op != OpIndex {
+				item.OpType = op
+			}
+		}
+	}
+	if item == nil || item.Index == "" || item.ID == "" {
+		return nil, fmt.Errorf("_index, _id is empty, input=%q", str)
+	}
+	if err := CheckOpType(item.OpType); err != nil {
+		return nil, err
+	}
+	if item.Op() == OpDelete {
+		return item, nil
+	}
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("invalid bulk lines, input=%q", str)
+	}
+	if err := item.setBulkBody(lines[1]); err != nil {
+		return nil, err
+	}
+	if item.Source == nil && item.Script == nil {
+		return nil, fmt.Errorf("_source is empty, input=%q", str)
+	}
+	return item, nil
+}
+
+// bulkMeta bulk 请求的 action 行中的元数据，routing 等参数不带下划线，es 7.0 之后不再支持带下划线的写法
+type bulkMeta struct {
+	Index         string `json:"_index"`
+	Type          string `json:"_type,omitempty"`
+	ID            string `json:"_id"`
+	Routing       string `json:"routing,omitempty"`
+	Parent        string `json:"parent,omitempty"`
+	Version       int64  `json:"version,omitempty"`
+	VersionType   string `json:"version_type,omitempty"`
+	IfSeqNo       *int64 `json:"if_seq_no,omitempty"`
+	IfPrimaryTerm int64  `json:"if_primary_term,omitempty"`
+}
+
+func (m *bulkMeta) dataItem() *DataItem {
+	return &DataItem{
+		Index:       m.Index,
+		Type:        m.Type,
+		ID:          m.ID,
+		Routing:     m.Routing,
+		Parent:      m.Parent,
+		Version:     m.Version,
+		VersionType: m.VersionType,
+		SeqNo:       m.IfSeqNo,
+		PrimaryTerm: m.IfPrimaryTerm,
+	}
+}
+
 // DataItem es 查询结果的一条数据
 type DataItem struct {
-	Index  string                 `json:"_index"`
-	Type   string                 `json:"_type"`
-	ID     string                 `json:"_id"`
+	Index   string `json:"_index"`
+	Type    string `json:"_type"`
+	ID      string `json:"_id"`
+	Routing string `json:"_routing,omitempty"`
+
+	// Parent es < 6.0 父子文档的父文档 _id，es >= 6.0 使用 join 字段，父子关系在 _source 中
+	Parent string `json:"_parent,omitempty"`
+
+	// Version 查询时需要 "version":true 才会返回
+	Version int64 `json:"_version,omitempty"`
+
+	// VersionType 写入时 version 的类型，如 external，不是 es 返回的字段
+	VersionType string `json:"version_type,omitempty"`
+
+	// SeqNo、PrimaryTerm 查询时需要 "seq_no_primary_term":true 才会返回，_seq_no 可以为 0
+	SeqNo       *int64 `json:"_seq_no,omitempty"`
+	PrimaryTerm int64  `json:"_primary_term,omitempty"`
+
+	// OpType bulk 的操作类型：index、create、update、delete，为空时为 index，data_fix_cmd 可以设置每条数据的操作
+	OpType string `json:"_op_type,omitempty"`
+
+	// Script OpType 为 update 时使用的脚本，为空时使用 _source 作为 doc 更新
+	Script map[string]interface{} `json:"_script,omitempty"`
+
+	// DocAsUpsert OpType 为 update 时，数据不存在则使用 _source 写入
+	DocAsUpsert bool `json:"_doc_as_upsert,omitempty"`
+
 	Source map[string]interface{} `json:"_source"`
 }
 
@@ -108,21 +288,52 @@ func (item *DataItem) String() string {
 
 // BulkString 输出为用于bulk命令的字符串
 func (item *DataItem) BulkString() string {
+	return item.BulkStringFor(nil)
+}
+
+// BulkStringFor 依据目标集群支持的功能输出 bulk 命令的字符串，操作类型由 OpType 决定，caps 为 nil 时不检查：
+// 集群不支持 _type 时不输出 _type，不支持 _parent 时使用 parent 作为 routing
+func (item *DataItem) BulkStringFor(caps *Capabilities) string {
+	meta := &bulkMeta{
+		Index:       item.Index,
+		ID:          item.ID,
+		Routing:     item.Routing,
+		Version:     item.Version,
+		VersionType: item.VersionType,
+	}
+	if item.Type != "" && (caps == nil || caps.Types) {
+		meta.Type = item.Type
+	}
+	if item.Parent != "" {
+		if caps == nil || caps.Parent {
+			meta.Parent = item.Parent
+		} else if meta.Routing == "" {
+			meta.Routing = item.Parent
+		}
+	}
+	op := item.Op()
+	// update 不支持 version_type
+	if item.VersionType == "" || op == OpUpdate {
+		meta.Version = 0
+		meta.VersionType = ""
+	}
+	if item.SeqNo != nil && item.PrimaryTerm > 0 {
+		meta.IfSeqNo = item.SeqNo
+		meta.IfPrimaryTerm = item.PrimaryTerm
+	}
 	header := map[string]interface{}{
-		"index": map[string]string{
-			"_index": item.Index,
-			"_type":  item.Type,
-			"_id":    item.ID,
-		},
+		op: meta,
 	}
 	hd, _ := json.Marshal(header)
-	bd, _ := json.Marshal(item.Source)
 
 	var builder strings.Builder
 	builder.Write(hd)
 	builder.WriteByte('\n')
-	builder.Write(bd)
-	builder.WriteByte('\n')
+	if body := item.bulkBody(); body != nil {
+		bd, _ := json.Marshal(body)
+		builder.Write(bd)
+		builder.WriteByte('\n')
+	}
 	return builder.String()
 }
 
@@ -135,6 +346,21 @@ func (item *DataItem) JSONBytes() []byte {
 	return s
 }
 
+// SetDefaults _source 中没有的字段使用 fields 中的值，有修改时返回 true
+func (item *DataItem) SetDefaults(fields map[string]interface{}) bool {
+	changed := false
+	for k, v := range fields {
+		if _, has := item.Source[k]; !has {
+			if item.Source == nil {
+				item.Source = make(map[string]interface{})
+			}
+			item.Source[k] = v
+			changed = true
+		}
+	}
+	return changed
+}
+
 // UniqID 返回数据唯一id
 func (item *DataItem) UniqID() string {
 	return strings.Join([]string{
@@ -159,7 +385,9 @@ type BulkResultItem struct {
 	ID      string `json:"_id"`
 	Version uint64 `json:"_version"`
 	Status  int    `json:"status"`
-	Error   string `json:"error"`
+
+	// Error 失败时的错误信息，成功时为 nil
+	Error *ErrorCause `json:"error"`
 }
 
 // UniqID 唯一id
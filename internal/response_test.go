@@ -7,6 +7,7 @@
 package internal
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -55,7 +56,7 @@ func TestBulkResultItem_UniqID(t *testing.T) {
 		ID      string
 		Version uint64
 		Status  int
-		Error   string
+		Error   *ErrorCause
 	}
 	tests := []struct {
 		name   string
@@ -70,7 +71,7 @@ func TestBulkResultItem_UniqID(t *testing.T) {
 				ID:      "id",
 				Version: 0,
 				Status:  0,
-				Error:   "",
+				Error:   nil,
 			},
 			want: "index|type|id",
 		},
@@ -91,3 +92,216 @@ func TestBulkResultItem_UniqID(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDataItemFromBulk(t *testing.T) {
+	tests := []struct {
+		name    string
+		str     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "case 1",
+			str:  (&DataItem{Index: "index", Type: "type", ID: "id", Source: map[string]interface{}{"a": 1}}).BulkString(),
+			want: "index|type|id",
+		},
+		{
+			name:    "no source",
+			str:     `{"index":{"_index":"index","_type":"type","_id":"id"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "no id",
+			str:     "{\"index\":{\"_index\":\"index\"}}\n{\"a\":1}\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDataItemFromBulk(tt.str)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDataItemFromBulk() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.UniqID() != tt.want || got.Source["a"] == nil {
+				t.Errorf("NewDataItemFromBulk() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDataItem_BulkStringFor(t *testing.T) {
+	var seqNo int64
+	tests := []struct {
+		name string
+		item *DataItem
+		caps *Capabilities
+		want string
+		body string
+	}{
+		{
+			name: "nil",
+			item: &DataItem{Index: "index", Type: "type", ID: "id"},
+			want: `{"index":{"_index":"index","_type":"type","_id":"id"}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "typeless",
+			item: &DataItem{Index: "index", Type: "type", ID: "id"},
+			caps: &Capabilities{},
+			want: `{"index":{"_index":"index","_id":"id"}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "routing and parent",
+			item: &DataItem{Index: "index", Type: "type", ID: "id", Routing: "r", Parent: "p"},
+			caps: &Capabilities{Types: true, Parent: true},
+			want: `{"index":{"_index":"index","_type":"type","_id":"id","routing":"r","parent":"p"}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "parent as routing",
+			item: &DataItem{Index: "index", ID: "id", Parent: "p"},
+			caps: &Capabilities{},
+			want: `{"index":{"_index":"index","_id":"id","routing":"p"}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "version without version_type",
+			item: &DataItem{Index: "index", ID: "id", Version: 3},
+			want: `{"index":{"_index":"index","_id":"id"}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "external version",
+			item: &DataItem{Index: "index", ID: "id", Version: 3, VersionType: "external"},
+			want: `{"index":{"_index":"index","_id":"id","version":3,"version_type":"external"}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "seq_no",
+			item: &DataItem{Index: "index", ID: "id", SeqNo: &seqNo, PrimaryTerm: 1},
+			want: `{"index":{"_index":"index","_id":"id","if_seq_no":0,"if_primary_term":1}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "create",
+			item: &DataItem{Index: "index", ID: "id", OpType: OpCreate, Version: 3, VersionType: "external"},
+			want: `{"create":{"_index":"index","_id":"id","version":3,"version_type":"external"}}`,
+			body: `{"a":1}`,
+		},
+		{
+			name: "update",
+			item: &DataItem{Index: "index", ID: "id", OpType: OpUpdate, Version: 3, VersionType: "external"},
+			want: `{"update":{"_index":"index","_id":"id"}}`,
+			body: `{"doc":{"a":1}}`,
+		},
+		{
+			name: "update doc_as_upsert",
+			item: &DataItem{Index: "index", ID: "id", OpType: OpUpdate, DocAsUpsert: true},
+			want: `{"update":{"_index":"index","_id":"id"}}`,
+			body: `{"doc":{"a":1},"doc_as_upsert":true}`,
+		},
+		{
+			name: "scripted update",
+			item: &DataItem{Index: "index", ID: "id", OpType: OpUpdate, DocAsUpsert: true, Script: map[string]interface{}{"source": "ctx._source.a++"}},
+			want: `{"update":{"_index":"index","_id":"id"}}`,
+			body: `{"script":{"source":"ctx._source.a++"},"upsert":{"a":1}}`,
+		},
+		{
+			name: "delete",
+			item: &DataItem{Index: "index", ID: "id", OpType: OpDelete},
+			want: `{"delete":{"_index":"index","_id":"id"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.item.Source = map[string]interface{}{"a": 1}
+			want := tt.want + "\n"
+			if tt.body != "" {
+				want += tt.body + "\n"
+			}
+			got := tt.item.BulkStringFor(tt.caps)
+			if got != want {
+				t.Fatalf("BulkStringFor() = %q, want %q", got, want)
+			}
+			item, err := NewDataItemFromBulk(got)
+			if err != nil {
+				t.Fatalf("NewDataItemFromBulk() error = %v", err)
+			}
+			if again := item.BulkStringFor(tt.caps); again != got {
+				t.Errorf("NewDataItemFromBulk().BulkStringFor() = %q, want %q", again, got)
+			}
+		})
+	}
+}
+
+func TestNewDataItem(t *testing.T) {
+	tests := []struct {
+		name    string
+		str     string
+		wantErr bool
+	}{
+		{
+			name: "typed",
+			str:  `{"_index":"index","_type":"type","_id":"1","_source":{"a":1}}`,
+		},
+		{
+			name: "typeless",
+			str:  `{"_index":"index","_id":"1","_source":{"a":1}}`,
+		},
+		{
+			name:    "no id",
+			str:     `{"_index":"index","_source":{"a":1}}`,
+			wantErr: true,
+		},
+		{
+			name: "delete without source",
+			str:  `{"_index":"index","_id":"1","_op_type":"delete"}`,
+		},
+		{
+			name:    "no source",
+			str:     `{"_index":"index","_id":"1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown op type",
+			str:     `{"_index":"index","_id":"1","_op_type":"upsert","_source":{"a":1}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDataItem(tt.str)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDataItem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScrollHits_UnmarshalJSON(t *testing.T) {
+	const resp = `{"_scroll_id":"s1","hits":{"total":{"value":2},"hits":[
+{"_index":"t","_id":"1","_source":{"n":1},"sort":["1"]},
+{"_index":"t","_id":"2","_source":{"n":2.5},"sort":["2",3]}]}}`
+	var sr *ScrollResponse
+	if err := jsonDecode([]byte(resp), &sr); err != nil {
+		t.Fatal(err)
+	}
+	if sr.Hits.Total != 2 || len(sr.Hits.Hits) != 2 {
+		t.Fatalf("hits = %+v", sr.Hits)
+	}
+	if got := fmt.Sprint(sr.lastSort()); got != "[2 3]" {
+		t.Errorf("lastSort() = %s, want [2 3]", got)
+	}
+	// sort 不输出到数据中
+	if got, want := sr.Hits.Hits[1].String(), `{"_index":"t","_type":"","_id":"2","_source":{"n":2.5}}`; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+
+	if got := NewScrollResponse(nil).lastSort(); got != nil {
+		t.Errorf("lastSort() of empty page = %v", got)
+	}
+}
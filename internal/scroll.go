@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 )
 
@@ -17,6 +18,15 @@ type Scroll struct {
 	loopNo    uint64
 	total     uint64
 	scrollPos uint64
+
+	// 断点续传，cp 非空时使用 search_after 分页
+	withCheckpoint
+	searchAfter []interface{}
+
+	slice *sliceInfo
+
+	mu     sync.Mutex // 保护 scrollID，Close 可能在其他 goroutine 中调用
+	closed bool
 }
 
 // NewScroll 创建一个scroll命令
@@ -38,88 +48,307 @@ func (s *Scroll) scrollTime() string {
 	return fmt.Sprintf("%ds", s.second)
 }
 
+// EnableCheckpoint 开启断点续传：使用 search_after 代替 scroll_id 进行分页，
+// 并定期将已确认(Ack)的进度写入 fileName，resume 为 true 时从 fileName 中的断点继续
+func (s *Scroll) EnableCheckpoint(fileName string, resume bool) error {
+	if !s.host.Vs.Capabilities().SearchAfter {
+		return fmt.Errorf("checkpoint requires search_after, es version must >= 5.0.0")
+	}
+	if s.slice != nil {
+		return fmt.Errorf("checkpoint can not be used with sliced scroll")
+	}
+	if s.host.Vs.Gte("8.0.0") && !hasIDTiebreaker(sortList((*s.query)["sort"])) {
+		// es 8.0 默认不能按 _id 排序(indices.id_field_data.enabled 为 false)，无法自动追加 _id
+		return fmt.Errorf("checkpoint with scroll reader on es >= 8.0 requires scan_query.sort to end with _id (indices.id_field_data.enabled), or use -reader pit")
+	}
+	s.cp = newCheckpointer(fileName, s.query)
+	if !resume {
+		return nil
+	}
+	cp, err := s.cp.load()
+	if err != nil {
+		return err
+	}
+	s.searchAfter = cp.SearchAfter
+	s.scrollPos = cp.Pos
+	s.loopNo = cp.LoopNo
+	s.total = cp.Total
+	log.Printf("[info] resume from checkpoint %q, loopNo=%d, total=%d, scrollPos=%d\n", fileName, s.loopNo, s.total, s.scrollPos)
+	return nil
+}
+
 // Next 获取下一页数据
 func (s *Scroll) Next() (*ScrollResponse, error) {
+	s.mu.Lock()
+	scrollID, closed := s.scrollID, s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("scroll is closed")
+	}
 
-	if s.scrollID == "" {
-		for {
-			sr, err := s.scan()
-
-			for i := 0; i < 10; i++ {
-				if err != nil {
-					time.Sleep(time.Second)
-					continue
-				}
-			}
-			if err != nil {
-				return nil, err
-			}
+	if s.cp != nil {
+		return s.nextSearchAfter()
+	}
 
-			if sr != nil {
-				if sr.IsError() {
-					return nil, sr.Error()
-				}
-				s.scrollID = sr.ScrollID
-				s.total = sr.Hits.Total
+	if scrollID == "" {
+		var sr *ScrollResponse
+		var err error
+		for try := 0; try < 10; try++ {
+			sr, err = s.scan()
+			if err == nil || !retryable(err) {
 				break
 			}
+			time.Sleep(time.Second)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sr.IsError() {
+			return nil, sr.Error()
+		}
+		scrollID = sr.ScrollID
+		s.setScrollID(scrollID)
+		if sr.Hits != nil {
+			s.total = uint64(sr.Hits.Total)
 		}
 
+		// es 5.0 之后没有 search_type=scan，首次查询就会返回第一页数据
+		if !s.host.Vs.Capabilities().Scan {
+			return s.onPage(sr), nil
+		}
 	}
-	s.loopNo++
 
-	if s.scrollID == "" {
+	if scrollID == "" {
 		return nil, fmt.Errorf("get scroll_id failed")
 	}
 
 	scanURI := "/_search/scroll?scroll=" + s.scrollTime()
 
 	var srt *ScrollResponse
+	var err error
 
 	for try := 0; try < 100; try++ {
 		postData := map[string]string{
 			"scroll":    s.scrollTime(),
-			"scroll_id": s.scrollID,
+			"scroll_id": scrollID,
 		}
 
 		bf, errJSON := json.Marshal(postData)
 		if errJSON != nil {
 			log.Fatalf("json.Marshal with error, data=%v, err=%v", postData, errJSON)
 		}
-		err := s.host.DoRequest("GET", scanURI, string(bf), &srt)
-		if err != nil {
+		err = s.host.DoRequest("GET", scanURI, string(bf), &srt)
+		if err != nil && retryable(err) {
 			log.Printf("[err] search_scroll failed, try=%d/100, error=%s\n", try, err.Error())
 			time.Sleep(time.Second)
 			continue
 		}
 		break
 	}
+	if err != nil {
+		s.host.speed.Fail("scroll_next", 1)
+		return nil, err
+	}
 
 	if srt.IsError() {
 		s.host.speed.Fail("scroll_next", 1)
 		return nil, srt.Error()
 	}
 
-	s.scrollPos += uint64(len(srt.Hits.Hits))
+	return s.onPage(srt), nil
+}
+
+func (s *Scroll) setScrollID(id string) {
+	s.mu.Lock()
+	s.scrollID = id
+	s.mu.Unlock()
+}
+
+// Close 清除 scroll 上下文，释放集群上的资源
+func (s *Scroll) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.scrollID == "" {
+		return nil
+	}
+	// es 1.x 的请求体为 scroll_id 原文
+	body := s.scrollID
+	if s.host.Vs.Gte("2.0.0") {
+		bf, _ := json.Marshal(map[string][]string{"scroll_id": {s.scrollID}})
+		body = string(bf)
+	}
+	var res ResponseBase
+	err := s.host.DoRequest("DELETE", "/_search/scroll", body, &res)
+	if err == nil && res.IsError() {
+		err = res.Error()
+	}
+	log.Println("[info] clear scroll, error=", err)
+	s.scrollID = ""
+	return err
+}
+
+// onPage 记录读取到的一页数据
+func (s *Scroll) onPage(srt *ScrollResponse) *ScrollResponse {
+	s.loopNo++
+	srt.seq = s.loopNo
+	srt.slice = s.sliceID()
+
+	num := 0
+	if srt.Hits != nil {
+		num = len(srt.Hits.Hits)
+	}
+	s.scrollPos += uint64(num)
+	s.setScrollID(srt.ScrollID)
+
+	s.host.speed.Success("scroll_next", 1)
+	s.host.speed.Success("scroll_result_items", num)
+
+	log.Printf("[info] scroll_next result, slice=%d, loopNo=%d, total=%d, scrollPos=%d\n", srt.slice, s.loopNo, s.total, s.scrollPos)
+	return srt
+}
+
+func (s *Scroll) nextSearchAfter() (*ScrollResponse, error) {
+	body := s.searchBody()
+	body["sort"] = s.searchAfterSort()
+	if len(s.searchAfter) > 0 {
+		body["search_after"] = s.searchAfter
+	}
+	if _, has := body["track_total_hits"]; !has && s.total == 0 && s.host.Vs.Gt("7.0.0") {
+		body["track_total_hits"] = true
+	}
+
+	srt, err := searchRetry(s.host, s.doc.URIFor(s.host.Vs.Capabilities())+"/_search", body.String())
+	if err != nil {
+		return nil, err
+	}
 
-	s.scrollID = srt.ScrollID
+	s.loopNo++
+	srt.seq = s.loopNo
+	srt.slice = s.sliceID()
+
+	if srt.HasMore() {
+		hits := srt.Hits.Hits
+		s.searchAfter = srt.lastSort()
+		s.scrollPos += uint64(len(hits))
+	}
+	if s.total == 0 && srt.Hits != nil {
+		s.total = uint64(srt.Hits.Total)
+	}
+	s.cp.read(srt.seq, &pageMark{searchAfter: s.searchAfter, pos: s.scrollPos}, s.total)
 
 	s.host.speed.Success("scroll_next", 1)
-	s.host.speed.Success("scroll_result_items", len(srt.Hits.Hits))
+	if srt.Hits != nil {
+		s.host.speed.Success("scroll_result_items", len(srt.Hits.Hits))
+	}
+
+	log.Printf("[info] search_after result, loopNo=%d, total=%d, scrollPos=%d\n", s.loopNo, s.total, s.scrollPos)
+
+	return srt, nil
+}
+
+// searchBody 查询语句，开启 slice 时会附带 slice 参数
+func (s *Scroll) searchBody() Query {
+	return newSearchBody(s.query, s.slice)
+}
 
-	log.Printf("[info] scroll_next result, loopNo=%d, total=%d, scrollPos=%d\n", s.loopNo, s.total, s.scrollPos)
+func newSearchBody(query *Query, slice *sliceInfo) Query {
+	body := make(Query, len(*query)+5)
+	for k, v := range *query {
+		body[k] = v
+	}
+	if slice != nil {
+		body["slice"] = slice
+	}
+	return body
+}
+
+// searchRetry 使用 search_after 分页查询，失败时重试
+func searchRetry(host *Host, uri string, body string) (*ScrollResponse, error) {
+	var srt *ScrollResponse
+	var err error
+	for try := 0; try < 100; try++ {
+		err = host.DoRequest("POST", uri, body, &srt)
+		if err != nil && retryable(err) {
+			log.Printf("[err] search_after failed, try=%d/100, error=%s\n", try, err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	if srt.IsError() {
+		host.speed.Fail("scroll_next", 1)
+		return nil, srt.Error()
+	}
 	return srt, nil
 }
 
+// searchAfterSort search_after 分页使用的排序，排序值需要唯一，否则排序值相同的数据在分页处会被跳过：
+// 查询中的 sort 最后不是 _id、_uid 时追加 _id(es < 6.0 为 _uid)。
+// es >= 8.0 不能按 _id 排序，EnableCheckpoint 时已检查
+func (s *Scroll) searchAfterSort() []interface{} {
+	sort := sortList((*s.query)["sort"])
+	if hasIDTiebreaker(sort) {
+		return sort
+	}
+	field := "_id"
+	if !s.host.Vs.Gt("6.0.0") {
+		field = "_uid"
+	}
+	return append(sort, map[string]string{field: "asc"})
+}
+
+// sortList 将查询中的 sort 转换为数组，sort 可以是字段名、对象或者数组
+func sortList(sort interface{}) []interface{} {
+	if sort == nil {
+		return nil
+	}
+	var v interface{}
+	bf, _ := json.Marshal(sort)
+	json.Unmarshal(bf, &v)
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return val
+	default:
+		return []interface{}{val}
+	}
+}
+
+// hasIDTiebreaker 排序的最后一个字段是否为 _id 或者 _uid
+func hasIDTiebreaker(sort []interface{}) bool {
+	if len(sort) == 0 {
+		return false
+	}
+	field := ""
+	switch val := sort[len(sort)-1].(type) {
+	case string:
+		field = val
+	case map[string]interface{}:
+		if len(val) == 1 {
+			for k := range val {
+				field = k
+			}
+		}
+	}
+	return field == "_id" || field == "_uid"
+}
+
 // https://www.elastic.co/guide/en/elasticsearch/reference/5.4/breaking_50_search_changes.html#_literal_search_type_scan_literal_removed
-func (s *Scroll) scan() (*ScanResponse, error) {
-	uri := s.doc.URI() + "/_search?scroll=" + s.scrollTime()
-	if !s.host.Vs.Gt("5.0.0") {
+func (s *Scroll) scan() (*ScrollResponse, error) {
+	caps := s.host.Vs.Capabilities()
+	uri := s.doc.URIFor(caps) + "/_search?scroll=" + s.scrollTime()
+	if caps.Scan {
 		uri += "&search_type=scan"
 	}
-	var sr *ScanResponse
-	qs := s.query.String()
+	var sr *ScrollResponse
+	body := s.searchBody()
+	qs := body.String()
 	err := s.host.DoRequest("GET", uri, qs, &sr)
 	log.Println("[info] scan, error=", err, ", result=", sr, ", uri=", uri, ", query=", qs)
 	return sr, err
@@ -0,0 +1,105 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestScroll_EnableCheckpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		query   Query
+		wantErr bool
+	}{
+		{name: "default sort", version: "7.10.0", query: Query{}},
+		{name: "es 8 default sort", version: "8.1.0", query: Query{}, wantErr: true},
+		{name: "es 8 sort without _id", version: "8.1.0", query: Query{"sort": []string{"id"}}, wantErr: true},
+		{name: "es 8 sort with _id", version: "8.1.0", query: Query{"sort": []interface{}{"ts", map[string]string{"_id": "desc"}}}},
+		{name: "es 2.x", version: "2.4.0", query: Query{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, host := newStubES(t, tt.version, 0)
+			s := NewScroll(host, &DocType{Index: "test"}, &tt.query)
+			err := s.EnableCheckpoint(filepath.Join(testTempDir(t), "checkpoint.json"), false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EnableCheckpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScroll_Close(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages int // Close 前读取的页数，3 时已读取完成
+	}{
+		{name: "not started", pages: 0},
+		{name: "reading", pages: 1},
+		{name: "finished", pages: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, host := newStubES(t, "7.10.0", 15)
+			s := NewScroll(host, &DocType{Index: "test"}, &Query{"size": 10})
+			for i := 0; i < tt.pages; i++ {
+				if _, err := s.Next(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if err := s.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := 1
+			if tt.pages == 0 {
+				want = 0
+			}
+			if n := es.count("DELETE /_search/scroll"); n != want {
+				t.Errorf("DELETE /_search/scroll %d times, want %d", n, want)
+			}
+			if _, err := s.Next(); err == nil {
+				t.Error("Next() after Close() should fail")
+			}
+		})
+	}
+}
+
+func TestScroll_searchAfterSort(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		sort    interface{}
+		want    string
+	}{
+		{name: "no sort", version: "7.10.0", want: `[{"_id":"asc"}]`},
+		{name: "no sort 5.x", version: "5.6.0", want: `[{"_uid":"asc"}]`},
+		{name: "field name", version: "7.10.0", sort: "ts", want: `["ts",{"_id":"asc"}]`},
+		{name: "not unique", version: "7.10.0", sort: []interface{}{map[string]interface{}{"ts": map[string]string{"order": "desc"}}}, want: `[{"ts":{"order":"desc"}},{"_id":"asc"}]`},
+		{name: "ends with _id", version: "7.10.0", sort: []interface{}{"ts", map[string]string{"_id": "desc"}}, want: `["ts",{"_id":"desc"}]`},
+		{name: "ends with _uid", version: "5.6.0", sort: []string{"ts", "_uid"}, want: `["ts","_uid"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, host := newStubES(t, tt.version, 0)
+			q := Query{}
+			if tt.sort != nil {
+				q["sort"] = tt.sort
+			}
+			s := NewScroll(host, &DocType{Index: "test"}, &q)
+			bf, _ := json.Marshal(s.searchAfterSort())
+			if got := string(bf); got != tt.want {
+				t.Errorf("searchAfterSort() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// resolveSecret 读取密码等敏感配置，避免在配置文件中写明文：
+// "${env:NAME}" 读取环境变量 NAME，"${file:/path/to/file}" 读取文件内容(去除首尾空白)，其他情况原样返回。
+// 明文本身以 "${" 开头时，写为 "$${...}"，去掉开头的一个 "$" 后原样返回
+func resolveSecret(value string) (string, error) {
+	if strings.HasPrefix(value, "$${") {
+		return value[1:], nil
+	}
+	if !strings.HasPrefix(value, "${") || !strings.HasSuffix(value, "}") {
+		return value, nil
+	}
+	ref := value[2 : len(value)-1]
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		v, has := os.LookupEnv(name)
+		if !has {
+			return "", fmt.Errorf("environment variable %q not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(ref, "file:"):
+		bs, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(bs)), nil
+	}
+	return "", fmt.Errorf("invalid secret reference %q, should be ${env:NAME} or ${file:/path}, use $${ for a literal value", value)
+}
+
+// maskHeader 用于打印日志，隐藏认证信息
+func maskHeader(header map[string]string) map[string]string {
+	masked := make(map[string]string, len(header))
+	for k, v := range header {
+		if strings.EqualFold(k, "Authorization") {
+			scheme := strings.SplitN(v, " ", 2)[0]
+			v = scheme + " ******"
+		}
+		masked[k] = v
+	}
+	return masked
+}
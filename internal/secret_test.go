@@ -0,0 +1,111 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHost_initAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es_tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(tokenFile, []byte("abc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("ES_TOOLS_TEST_PASSWORD", "pass")
+	defer os.Unsetenv("ES_TOOLS_TEST_PASSWORD")
+
+	tests := []struct {
+		name    string
+		host    *Host
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "basic with env password",
+			host: &Host{User: "user", Password: "${env:ES_TOOLS_TEST_PASSWORD}"},
+			want: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name: "api key id:key",
+			host: &Host{APIKey: "id:key"},
+			want: "ApiKey aWQ6a2V5",
+		},
+		{
+			name: "api key encoded",
+			host: &Host{APIKey: "aWQ6a2V5"},
+			want: "ApiKey aWQ6a2V5",
+		},
+		{
+			name: "bearer token from file",
+			host: &Host{BearerToken: "${file:" + tokenFile + "}"},
+			want: "Bearer abc",
+		},
+		{
+			name:    "missing env",
+			host:    &Host{BearerToken: "${env:ES_TOOLS_TEST_NOT_EXISTS}"},
+			wantErr: true,
+		},
+		{
+			name:    "multi auth",
+			host:    &Host{User: "user", APIKey: "id:key"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.host.Header = make(map[string]string)
+			err := tt.host.initAuth()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("initAuth() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := tt.host.Header["Authorization"]; got != tt.want {
+				t.Errorf("Authorization = %v, want %v", got, tt.want)
+			}
+			if tt.want != "" && maskHeader(tt.host.Header)["Authorization"] == tt.want {
+				t.Errorf("maskHeader() not masked")
+			}
+		})
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	os.Setenv("ES_TOOLS_TEST_SECRET", "s1")
+	defer os.Unsetenv("ES_TOOLS_TEST_SECRET")
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "plain", want: "plain"},
+		{value: "env:ES_TOOLS_TEST_SECRET", want: "env:ES_TOOLS_TEST_SECRET"},
+		{value: "file:/etc/passwd", want: "file:/etc/passwd"},
+		{value: "${env:ES_TOOLS_TEST_SECRET}", want: "s1"},
+		{value: "$${env:ES_TOOLS_TEST_SECRET}", want: "${env:ES_TOOLS_TEST_SECRET}"},
+		{value: "${abc", want: "${abc"},
+		{value: "${abc}", wantErr: true},
+		{value: "${file:/not/exists}", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := resolveSecret(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveSecret(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveSecret(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 进程退出码
+const (
+	ExitInterrupted = 3 // 收到信号，已读取的数据处理完成后退出
+	ExitForceQuit   = 4 // 再次收到信号，强制退出
+)
+
+// HandleSignal 第一次收到 SIGINT、SIGTERM 时调用 stop，停止读取数据并等待已读取的数据处理完成；
+// 再次收到信号时调用 cleanup 保存断点、释放集群上的资源，之后以 ExitForceQuit 退出。
+// status 返回日志中附带的计数器，可以为 nil
+func HandleSignal(stop func(), cleanup func(), status func() string) {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		log.Println("[info] receive signal:", sig, ", stop reading and wait the read data, send again to force quit", signalStatus(status))
+		stop()
+
+		sig = <-ch
+		log.Println("[info] receive signal:", sig, ", force quit", signalStatus(status))
+		if cleanup != nil {
+			cleanup()
+		}
+		os.Exit(ExitForceQuit)
+	}()
+}
+
+func signalStatus(status func() string) string {
+	if status == nil {
+		return ""
+	}
+	return status()
+}
+
+// HandleReload 收到 SIGHUP 时重新读取配置文件中的 throttle，修改写入速度，没有 throttle 时不限速
+func HandleReload(confName string, throttle *Throttle) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := reloadThrottle(confName, throttle); err != nil {
+				log.Println("[err] reload config failed:", err)
+			}
+		}
+	}()
+}
+
+func reloadThrottle(confName string, throttle *Throttle) error {
+	bs, err := ioutil.ReadFile(confName)
+	if err != nil {
+		return err
+	}
+	var c struct {
+		Throttle *ThrottleConfig `json:"throttle"`
+	}
+	if err = json.Unmarshal(bs, &c); err != nil {
+		return err
+	}
+	if c.Throttle == nil {
+		c.Throttle = &ThrottleConfig{}
+	}
+	throttle.SetRate(c.Throttle.DocsPerSec, c.Throttle.BytesPerSec)
+	return nil
+}
+
+// IsStopped stop 是否已关闭
+func IsStopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// sliceInfo sliced scroll 的分片信息
+type sliceInfo struct {
+	ID  int `json:"id"`
+	Max int `json:"max"`
+}
+
+// SetSlice 设置 sliced scroll 的分片，id 从 0 开始
+func (s *Scroll) SetSlice(id int, max int) {
+	s.slice = &sliceInfo{
+		ID:  id,
+		Max: max,
+	}
+}
+
+func (s *Scroll) sliceID() int {
+	if s.slice == nil {
+		return 0
+	}
+	return s.slice.ID
+}
+
+// ReadSlices 每个 Reader 使用一个独立的 goroutine 并发读取，
+// 每读取到一页数据（包括最后的空页）调用一次 fn，fn 返回 false 时停止读取，
+// 全部读取完成、停止或者出错时返回
+func ReadSlices(readers []Reader, fn func(sr *ScrollResponse) bool) error {
+	var wg sync.WaitGroup
+	var stopped int32
+	var once sync.Once
+	var firstErr error
+
+	for i, r := range readers {
+		wg.Add(1)
+		go func(slice int, r Reader) {
+			defer wg.Done()
+			for atomic.LoadInt32(&stopped) == 0 {
+				sr, err := r.Next()
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("slice=%d, %w", slice, err)
+					})
+					atomic.StoreInt32(&stopped, 1)
+					return
+				}
+				if !fn(sr) {
+					atomic.StoreInt32(&stopped, 1)
+					return
+				}
+				if !sr.HasMore() {
+					return
+				}
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	return firstErr
+}
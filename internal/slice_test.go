@@ -0,0 +1,112 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReadSlices(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		slices    int
+		failSlice int
+		stopAfter int // fn 返回 false 前读取的页数，为 0 时不停止
+
+		wantErr   bool        // 出错时其他 slice 读取的页数不确定，只检查错误
+		wantPages map[int]int // 每个 slice 读取的页数(包括最后的空页)
+		wantDocs  int
+	}{
+		{
+			name:      "scroll slices",
+			kind:      ReaderScroll,
+			slices:    3,
+			failSlice: -1,
+			wantPages: map[int]int{0: 4, 1: 4, 2: 4},
+			wantDocs:  75,
+		},
+		{
+			name:      "pit slices",
+			kind:      ReaderPIT,
+			slices:    2,
+			failSlice: -1,
+			wantPages: map[int]int{0: 4, 1: 4},
+			wantDocs:  50,
+		},
+		{
+			name:      "stop",
+			kind:      ReaderScroll,
+			slices:    1,
+			failSlice: -1,
+			stopAfter: 2,
+			wantPages: map[int]int{0: 2},
+			wantDocs:  20,
+		},
+		{
+			name:      "slice error",
+			kind:      ReaderScroll,
+			slices:    2,
+			failSlice: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, host := newStubES(t, "7.17.0", 25)
+			es.failSlice = tt.failSlice
+			query := &Query{"size": 10}
+			readers, err := NewReaders(host, &DocType{Index: "test"}, query, &ReaderOption{Kind: tt.kind, Slices: tt.slices})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			pages := make(map[int]int)
+			ids := make(map[string]bool)
+			err = ReadSlices(readers, func(sr *ScrollResponse) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				pages[sr.Slice()]++
+				if sr.HasMore() {
+					for _, item := range sr.Hits.Hits {
+						ids[item.ID] = true
+					}
+				}
+				return tt.stopAfter == 0 || pages[sr.Slice()] < tt.stopAfter
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSlices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if want := fmt.Sprintf("slice=%d", tt.failSlice); !strings.Contains(err.Error(), want) || pages[tt.failSlice] != 0 {
+					t.Errorf("ReadSlices() error = %v, pages = %v", err, pages)
+				}
+				return
+			}
+			if len(pages) != len(tt.wantPages) {
+				t.Errorf("pages = %v, want %v", pages, tt.wantPages)
+			}
+			for slice, n := range tt.wantPages {
+				if pages[slice] != n {
+					t.Errorf("slice %d pages = %d, want %d", slice, pages[slice], n)
+				}
+			}
+			if len(ids) != tt.wantDocs {
+				t.Errorf("docs = %d, want %d", len(ids), tt.wantDocs)
+			}
+			for i, r := range readers {
+				if _, ok := tt.wantPages[i]; ok && tt.stopAfter == 0 && r.Total() != 25 {
+					t.Errorf("slice %d Total() = %d, want 25", i, r.Total())
+				}
+			}
+		})
+	}
+}
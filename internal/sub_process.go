@@ -17,6 +17,9 @@ type SubProcess struct {
 	cmd    *exec.Cmd
 	reader *bufio.Reader
 	writer io.WriteCloser
+
+	// closeTimeout Close 时等待子进程退出的时间，超时后强制结束
+	closeTimeout time.Duration
 }
 
 // NewSubProcess 创建一个新的子进程
@@ -26,8 +29,9 @@ func NewSubProcess(cmdStr string, id string) (*SubProcess, error) {
 		return nil, fmt.Errorf("call NewSubProcess with empty command line,id=%s", id)
 	}
 	task := &SubProcess{
-		cmdStr: cmdStr,
-		id:     id,
+		cmdStr:       cmdStr,
+		id:           id,
+		closeTimeout: 10 * time.Second,
 	}
 	var err error
 	for {
@@ -50,7 +54,7 @@ func (task *SubProcess) start() (err error) {
 	task.log("starting")
 
 	if task.cmd != nil && task.cmd.Process != nil {
-		task.cmd.Process.Kill()
+		killProcess(task.cmd)
 	}
 
 	defer func() {
@@ -61,6 +65,8 @@ func (task *SubProcess) start() (err error) {
 		}
 	}()
 	cmd := exec.Command("sh", "-c", task.cmdStr)
+	// 使用独立的进程组，终端的 Ctrl-C 不会直接结束子进程，由程序处理完剩余数据后关闭
+	setProcessGroup(cmd)
 
 	var stdin io.WriteCloser
 	stdin, err = cmd.StdinPipe()
@@ -85,8 +91,11 @@ func (task *SubProcess) start() (err error) {
 		reader := bufio.NewReader(errorReader)
 		for {
 			l, e := reader.ReadString('\n')
-			task.log("cmd_stderr:", strings.TrimSpace(l), e)
-			if cmd.ProcessState == nil || cmd.ProcessState.Exited() {
+			if l = strings.TrimSpace(l); l != "" {
+				task.log("cmd_stderr:", l)
+			}
+			if e != nil {
+				// 子进程退出后 stderr 关闭
 				task.log("subprocess is Exited")
 				break
 			}
@@ -129,7 +138,49 @@ write:
 	return strings.TrimSpace(resp), nil
 }
 
-// Close 子进程关闭
+// Close 关闭子进程的输入，并等待子进程退出，超时后会强制结束子进程
 func (task *SubProcess) Close() error {
-	return task.writer.Close()
+	err := task.writer.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- task.cmd.Wait()
+	}()
+	select {
+	case e := <-done:
+		if err == nil {
+			err = e
+		}
+		task.log("exited")
+	case <-time.After(task.closeTimeout):
+		task.log("wait exit timeout, kill it")
+		killProcess(task.cmd)
+		if e := <-done; err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// FixItem 使用子进程处理一条数据(json)，返回子进程的输出和解析后的数据，输出为空时表示跳过该数据。
+// 子进程出错或者输出的不是正确的数据时，每秒重试一次，直到成功
+func (task *SubProcess) FixItem(raw string) (string, *DataItem) {
+	for try := 1; ; try++ {
+		res, err := task.Deal(raw)
+		if err != nil {
+			log.Println("[err] fixer_deal with error:", err, "try_times=", try, "input=", raw)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		// 若处理后，返回空字符串，则这条数据会跳过，不处理
+		if res == "" {
+			return "", nil
+		}
+		item, err := NewDataItem(res)
+		if err != nil {
+			log.Println("[err] fixer_data with error:", err, "try_times=", try, "raw=", raw, "new_str=", res)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+		return res, item
+	}
 }
@@ -0,0 +1,58 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubProcess_Close(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmd     string
+		killed  bool
+		maxWait time.Duration
+	}{
+		{
+			name:    "exit after stdin closed",
+			cmd:     "cat",
+			maxWait: time.Second,
+		},
+		{
+			name:    "kill after timeout",
+			cmd:     "trap '' TERM; cat; sleep 30",
+			killed:  true,
+			maxWait: 5 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, err := NewSubProcess(tt.cmd, "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			task.closeTimeout = 100 * time.Millisecond
+			got, err := task.Deal(`{"_id":"1"}`)
+			if err != nil || got != `{"_id":"1"}` {
+				t.Fatalf("Deal() = %q, %v", got, err)
+			}
+
+			start := time.Now()
+			err = task.Close()
+			if cost := time.Since(start); cost > tt.maxWait {
+				t.Errorf("Close() cost %s", cost)
+			}
+			if killed := err != nil; killed != tt.killed {
+				t.Errorf("Close() error = %v, killed want %v", err, tt.killed)
+			}
+			if !task.cmd.ProcessState.Exited() && !tt.killed {
+				t.Errorf("process not exited: %s", task.cmd.ProcessState)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package internal
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 子进程使用独立的进程组
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcess 结束子进程所在的进程组，包括 sh -c 启动的命令
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package internal
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
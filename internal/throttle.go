@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// TokenBucket 令牌桶限速，每秒产生 rate 个令牌，最多积累 1 秒的令牌，rate <= 0 时不限速
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewTokenBucket 创建令牌桶
+func NewTokenBucket(rate float64) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// SetRate 修改速度，可以在运行中调用
+func (b *TokenBucket) SetRate(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.rate = rate
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+}
+
+// Rate 当前的速度
+func (b *TokenBucket) Rate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+func (b *TokenBucket) refill() {
+	now := b.now()
+	if b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+}
+
+// reserve 取出 n 个令牌，返回需要等待的时间。令牌不足时先欠着，所以 n 可以大于 rate
+func (b *TokenBucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill()
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Wait 等待 n 个令牌
+func (b *TokenBucket) Wait(n int) {
+	if d := b.reserve(n); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// ThrottleConfig 写入限速的配置
+type ThrottleConfig struct {
+	// DocsPerSec 每秒写入的条数，为 0 时不限制，adaptive 时为初始速度
+	DocsPerSec float64 `json:"docs_per_sec"`
+
+	// BytesPerSec 每秒写入的字节数，为 0 时不限制
+	BytesPerSec float64 `json:"bytes_per_sec"`
+
+	// Adaptive 依据 bulk 的耗时和 429 自动调整 docs_per_sec：
+	// 耗时超过 target_latency 或者有数据被拒绝时速度减半，连续 increase_interval 没有过载时增加初始速度的 10%
+	Adaptive bool `json:"adaptive"`
+
+	// MinDocsPerSec、MaxDocsPerSec adaptive 时速度的范围，默认为 10 和 docs_per_sec 的 10 倍
+	MinDocsPerSec float64 `json:"min_docs_per_sec"`
+	MaxDocsPerSec float64 `json:"max_docs_per_sec"`
+
+	// TargetLatency adaptive 时期望的 bulk 耗时，默认为 2s
+	TargetLatency string `json:"target_latency"`
+
+	// IncreaseInterval adaptive 时加速的间隔，默认为 5s，和 bulk 的次数、worker 数无关
+	IncreaseInterval string `json:"increase_interval"`
+}
+
+// Throttle 写入限速，nil 时不限速
+type Throttle struct {
+	docs  *TokenBucket
+	bytes *TokenBucket
+
+	adaptive      bool
+	minDocs       float64
+	maxDocs       float64
+	step          float64
+	targetLatency time.Duration
+	increase      time.Duration
+
+	mu           sync.Mutex
+	lastDecrease time.Time
+	lastChange   time.Time // 上次调整速度或者过载的时间
+	now          func() time.Time
+}
+
+// NewThrottle 创建限速，c 为 nil 时返回 nil
+func NewThrottle(c *ThrottleConfig) (*Throttle, error) {
+	if c == nil {
+		return nil, nil
+	}
+	t := &Throttle{
+		docs:     NewTokenBucket(c.DocsPerSec),
+		bytes:    NewTokenBucket(c.BytesPerSec),
+		adaptive: c.Adaptive,
+		now:      time.Now,
+	}
+	if !c.Adaptive {
+		return t, nil
+	}
+	if c.DocsPerSec <= 0 {
+		return nil, fmt.Errorf("throttle.adaptive requires throttle.docs_per_sec > 0")
+	}
+	t.minDocs = c.MinDocsPerSec
+	if t.minDocs <= 0 {
+		t.minDocs = 10
+	}
+	t.maxDocs = c.MaxDocsPerSec
+	if t.maxDocs <= 0 {
+		t.maxDocs = c.DocsPerSec * 10
+	}
+	if t.minDocs > t.maxDocs {
+		return nil, fmt.Errorf("throttle.min_docs_per_sec %v > max_docs_per_sec %v", t.minDocs, t.maxDocs)
+	}
+	t.step = c.DocsPerSec / 10
+	t.targetLatency = 2 * time.Second
+	if c.TargetLatency != "" {
+		var err error
+		if t.targetLatency, err = time.ParseDuration(c.TargetLatency); err != nil {
+			return nil, fmt.Errorf("invalid throttle.target_latency %q: %w", c.TargetLatency, err)
+		}
+	}
+	t.increase = 5 * time.Second
+	if c.IncreaseInterval != "" {
+		var err error
+		if t.increase, err = time.ParseDuration(c.IncreaseInterval); err != nil {
+			return nil, fmt.Errorf("invalid throttle.increase_interval %q: %w", c.IncreaseInterval, err)
+		}
+	}
+	t.lastChange = t.now()
+	return t, nil
+}
+
+// Wait 写入 docs 条、bytes 字节的数据前调用，超过速度时等待
+func (t *Throttle) Wait(docs int, bytes int) {
+	if t == nil {
+		return
+	}
+	t.docs.Wait(docs)
+	t.bytes.Wait(bytes)
+}
+
+// Feedback 每次 bulk 之后调用，adaptive 时依据耗时和被拒绝(429)的条数调整速度：
+// 过载时立即减速，距离上次调整或过载超过 increase_interval 时才加速，避免多个 worker 频繁调用时很快恢复到最大速度
+func (t *Throttle) Feedback(latency time.Duration, rejected int) {
+	if t == nil || !t.adaptive {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rate := t.docs.Rate()
+	if rate <= 0 {
+		// 运行中设置为不限速后，从最大速度开始调整
+		rate = t.maxDocs
+	}
+	now := t.now()
+	if rejected > 0 || latency > t.targetLatency {
+		t.lastChange = now
+		// 多个 worker 同时返回时只减速一次
+		if now.Sub(t.lastDecrease) < time.Second {
+			return
+		}
+		t.lastDecrease = now
+		newRate := rate / 2
+		if newRate < t.minDocs {
+			newRate = t.minDocs
+		}
+		if newRate != rate {
+			log.Printf("[info] throttle slow down, docs_per_sec=%.1f, latency=%s, rejected=%d\n", newRate, latency, rejected)
+			t.docs.SetRate(newRate)
+		}
+		return
+	}
+	if now.Sub(t.lastChange) < t.increase {
+		return
+	}
+	t.lastChange = now
+	newRate := rate + t.step
+	if newRate > t.maxDocs {
+		newRate = t.maxDocs
+	}
+	if newRate != rate {
+		t.docs.SetRate(newRate)
+	}
+}
+
+// SetRate 修改速度，为 0 时不限速，adaptive 时 docs 为当前速度
+func (t *Throttle) SetRate(docs float64, bytes float64) {
+	if t == nil {
+		return
+	}
+	t.docs.SetRate(docs)
+	t.bytes.SetRate(bytes)
+	log.Printf("[info] throttle set rate, docs_per_sec=%.1f, bytes_per_sec=%.1f\n", docs, bytes)
+}
+
+// Rates 当前的速度
+func (t *Throttle) Rates() (docs float64, bytes float64) {
+	if t == nil {
+		return 0, 0
+	}
+	return t.docs.Rate(), t.bytes.Rate()
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_reserve(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	b := NewTokenBucket(100)
+	b.now = func() time.Time {
+		return now
+	}
+	b.last = now
+
+	steps := []struct {
+		name    string
+		elapsed time.Duration
+		n       int
+		want    time.Duration
+	}{
+		{name: "burst", n: 100, want: 0},
+		{name: "empty", n: 50, want: 500 * time.Millisecond},
+		{name: "refill", elapsed: time.Second, n: 10, want: 0},
+		{name: "larger than rate", n: 300, want: 2600 * time.Millisecond},
+	}
+	for _, st := range steps {
+		now = now.Add(st.elapsed)
+		if got := b.reserve(st.n); got != st.want {
+			t.Errorf("%s: reserve(%d) = %v, want %v", st.name, st.n, got, st.want)
+		}
+	}
+
+	b.SetRate(0)
+	if got := b.reserve(1000); got != 0 {
+		t.Errorf("unlimited: reserve() = %v, want 0", got)
+	}
+}
+
+func TestThrottle_Feedback(t *testing.T) {
+	th, err := NewThrottle(&ThrottleConfig{
+		DocsPerSec:       100,
+		Adaptive:         true,
+		MinDocsPerSec:    30,
+		MaxDocsPerSec:    120,
+		TargetLatency:    "1s",
+		IncreaseInterval: "5s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	th.now = func() time.Time {
+		return now
+	}
+	th.lastChange = now
+	steps := []struct {
+		name     string
+		elapsed  time.Duration
+		latency  time.Duration
+		rejected int
+		want     float64
+	}{
+		{name: "healthy within interval", latency: 100 * time.Millisecond, want: 100},
+		{name: "healthy", elapsed: 5 * time.Second, latency: 100 * time.Millisecond, want: 110},
+		{name: "many calls", elapsed: time.Second, latency: 100 * time.Millisecond, want: 110},
+		{name: "max", elapsed: 5 * time.Second, latency: 100 * time.Millisecond, want: 120},
+		{name: "max again", elapsed: 5 * time.Second, latency: 100 * time.Millisecond, want: 120},
+		{name: "rejected", rejected: 1, want: 60},
+		{name: "slow within 1s", latency: 3 * time.Second, want: 60},
+		{name: "healthy after slow", elapsed: 4 * time.Second, latency: 100 * time.Millisecond, want: 60},
+		{name: "recover", elapsed: time.Second, latency: 100 * time.Millisecond, want: 70},
+		{name: "slow", elapsed: 2 * time.Second, latency: 3 * time.Second, want: 35},
+		{name: "min", elapsed: 2 * time.Second, latency: 3 * time.Second, want: 30},
+	}
+	for _, st := range steps {
+		now = now.Add(st.elapsed)
+		th.Feedback(st.latency, st.rejected)
+		if got, _ := th.Rates(); got != st.want {
+			t.Errorf("%s: docs_per_sec = %v, want %v", st.name, got, st.want)
+		}
+	}
+
+	if _, err = NewThrottle(&ThrottleConfig{Adaptive: true}); err == nil {
+		t.Error("adaptive without docs_per_sec should fail")
+	}
+	var nilThrottle *Throttle
+	nilThrottle.Wait(1, 1)
+	nilThrottle.Feedback(time.Second, 1)
+}
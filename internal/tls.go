@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLSConfig https 连接的配置
+type TLSConfig struct {
+	// CAFile 用于校验服务端证书的 CA 证书(PEM 格式)，为空时使用系统的 CA
+	CAFile string `json:"ca_file"`
+
+	// CertFile、KeyFile 客户端证书和私钥(PEM 格式)，用于双向认证(mTLS)
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+
+	// ServerName 校验服务端证书时使用的域名，为空时使用 addr 中的域名
+	ServerName string `json:"server_name"`
+
+	// Insecure 不校验服务端证书，仅用于测试
+	Insecure bool `json:"insecure"`
+}
+
+// Build 创建 tls.Config
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.Insecure,
+	}
+	if c.CAFile != "" {
+		bs, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls.ca_file failed: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bs) {
+			return nil, fmt.Errorf("no valid certificate in tls.ca_file %q", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate failed: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
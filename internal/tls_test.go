@@ -0,0 +1,80 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHost_TLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "es_tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err = ioutil.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tls     *TLSConfig
+		wantErr bool
+	}{
+		{
+			name:    "no ca",
+			tls:     nil,
+			wantErr: true,
+		},
+		{
+			name: "ca file",
+			tls: &TLSConfig{
+				CAFile:     caFile,
+				ServerName: "example.com",
+			},
+		},
+		{
+			name: "insecure",
+			tls: &TLSConfig{
+				Insecure: true,
+			},
+		},
+		{
+			name: "cert without key",
+			tls: &TLSConfig{
+				CertFile: caFile,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Host{
+				Address: ts.URL,
+				TLS:     tt.tls,
+			}
+			err := h.Init()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// TransportConfig http 连接的配置：超时、连接池、代理、压缩
+type TransportConfig struct {
+	// Timeout 单次请求的超时时间(包括读取响应内容)，如 60s，为空时不超时
+	Timeout string `json:"timeout"`
+
+	// DialTimeout 建立连接的超时时间，默认为 30s
+	DialTimeout string `json:"dial_timeout"`
+
+	// MaxIdleConnsPerHost 每个节点保持的最大空闲连接数，默认为 2，bulk_worker 较多时可以调大
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+
+	// Proxy http 代理地址，如 http://127.0.0.1:3128，为空时使用环境变量 HTTP_PROXY、HTTPS_PROXY
+	Proxy string `json:"proxy"`
+
+	// Gzip 为 true 时 bulk 请求体使用 gzip 压缩，需要 es 开启 http.compression
+	Gzip bool `json:"gzip"`
+
+	// NoGzipResponse 默认会发送 Accept-Encoding: gzip 请求压缩的响应并自动解压，为 true 时不压缩响应
+	NoGzipResponse bool `json:"no_gzip_response"`
+}
+
+func parseDuration(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return d, nil
+}
+
+// apply 将配置应用到 transport 上
+func (c *TransportConfig) apply(transport *http.Transport) error {
+	dialTimeout, err := parseDuration("transport.dial_timeout", c.DialTimeout)
+	if err != nil {
+		return err
+	}
+	if dialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < c.MaxIdleConnsPerHost {
+			transport.MaxIdleConns = c.MaxIdleConnsPerHost
+		}
+	}
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid transport.proxy %q: %w", c.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	// 未设置 Accept-Encoding 时，transport 会自动请求 gzip 压缩的响应并解压
+	transport.DisableCompression = c.NoGzipResponse
+	return nil
+}
+
+// timeout 单次请求的超时时间
+func (c *TransportConfig) timeout() (time.Duration, error) {
+	return parseDuration("transport.timeout", c.Timeout)
+}
+
+// gzipBytes 使用 gzip 压缩数据
+func gzipBytes(bs []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(bs); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHost_Transport(t *testing.T) {
+	var bulkBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_bulk":
+			body := r.Body
+			if r.Header.Get("Content-Encoding") == "gzip" {
+				gr, err := gzip.NewReader(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				body = gr
+			}
+			bs, _ := ioutil.ReadAll(body)
+			bulkBody = string(bs)
+			w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		transport   *TransportConfig
+		wantInitErr bool
+		wantSlowErr bool
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "gzip and timeout",
+			transport: &TransportConfig{
+				Timeout:             "100ms",
+				DialTimeout:         "1s",
+				MaxIdleConnsPerHost: 10,
+				Gzip:                true,
+			},
+			wantSlowErr: true,
+		},
+		{
+			name: "invalid timeout",
+			transport: &TransportConfig{
+				Timeout: "abc",
+			},
+			wantInitErr: true,
+		},
+		{
+			name: "invalid proxy",
+			transport: &TransportConfig{
+				Proxy: "://",
+			},
+			wantInitErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Host{
+				Address:   ts.URL,
+				Transport: tt.transport,
+			}
+			err := h.Init()
+			if (err != nil) != tt.wantInitErr {
+				t.Fatalf("Init() error = %v, wantInitErr %v", err, tt.wantInitErr)
+			}
+			if err != nil {
+				return
+			}
+
+			bulkBody = ""
+			payload := "{\"index\":{\"_id\":\"1\"}}\n{\"a\":1}\n"
+			var res BulkResponse
+			if err = h.BulkStream(strings.NewReader(payload), &res); err != nil {
+				t.Fatalf("BulkStream() error = %v", err)
+			}
+			if bulkBody != payload {
+				t.Errorf("bulk body = %q, want %q", bulkBody, payload)
+			}
+
+			var slow ResponseBase
+			err = h.DoRequest("GET", "/slow", "", &slow)
+			if (err != nil) != tt.wantSlowErr {
+				t.Errorf("slow request error = %v, wantSlowErr %v", err, tt.wantSlowErr)
+			}
+		})
+	}
+}
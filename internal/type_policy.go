@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// 源索引有多个 _type，写入不支持 _type 的集群时的处理方式
+const (
+	// TypePolicyMerge 直接去掉 _type，不同 _type 下相同 _id 的数据会相互覆盖
+	TypePolicyMerge = "merge"
+
+	// TypePolicyPrefixID 使用 {_type}-{_id} 作为新的 _id
+	TypePolicyPrefixID = "prefix_id"
+
+	// TypePolicyTypeField 去掉 _type，并将 _type 保存到 _source 的字段中
+	TypePolicyTypeField = "type_field"
+)
+
+// CheckTypePolicy 检查 type_policy 配置是否正确，允许为空
+func CheckTypePolicy(policy string) error {
+	switch policy {
+	case "", TypePolicyMerge, TypePolicyPrefixID, TypePolicyTypeField:
+		return nil
+	}
+	return fmt.Errorf("unknown type_policy %q, should be one of: merge, prefix_id, type_field", policy)
+}
+
+// RemoveType 按照 policy 去掉数据的 _type，policy 为 type_field 时 _type 保存到 _source 的 field 字段中
+func (item *DataItem) RemoveType(policy string, field string) {
+	if item.Type == "" {
+		return
+	}
+	switch policy {
+	case TypePolicyPrefixID:
+		item.ID = item.Type + "-" + item.ID
+	case TypePolicyTypeField:
+		if field == "" {
+			field = "type"
+		}
+		if item.Source == nil {
+			item.Source = make(map[string]interface{})
+		}
+		item.Source[field] = item.Type
+	}
+	item.Type = ""
+}
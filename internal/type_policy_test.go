@@ -0,0 +1,68 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDataItem_RemoveType(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		field      string
+		itemType   string
+		wantID     string
+		wantSource map[string]interface{}
+	}{
+		{
+			name:       "merge",
+			policy:     TypePolicyMerge,
+			itemType:   "user",
+			wantID:     "1",
+			wantSource: map[string]interface{}{"a": 1},
+		},
+		{
+			name:       "prefix_id",
+			policy:     TypePolicyPrefixID,
+			itemType:   "user",
+			wantID:     "user-1",
+			wantSource: map[string]interface{}{"a": 1},
+		},
+		{
+			name:       "type_field default",
+			policy:     TypePolicyTypeField,
+			itemType:   "user",
+			wantID:     "1",
+			wantSource: map[string]interface{}{"a": 1, "type": "user"},
+		},
+		{
+			name:       "type_field",
+			policy:     TypePolicyTypeField,
+			field:      "doc_type",
+			itemType:   "user",
+			wantID:     "1",
+			wantSource: map[string]interface{}{"a": 1, "doc_type": "user"},
+		},
+		{
+			name:       "typeless",
+			policy:     TypePolicyPrefixID,
+			wantID:     "1",
+			wantSource: map[string]interface{}{"a": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &DataItem{Index: "index", Type: tt.itemType, ID: "1", Source: map[string]interface{}{"a": 1}}
+			item.RemoveType(tt.policy, tt.field)
+			if item.Type != "" || item.ID != tt.wantID || !reflect.DeepEqual(item.Source, tt.wantSource) {
+				t.Errorf("RemoveType() = %+v, want id=%s source=%v", item, tt.wantID, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// WriteConfig es_reindex、es_load 共用的写入配置
+type WriteConfig struct {
+	// FieldsDefault _source 中没有的字段使用该值
+	FieldsDefault map[string]interface{} `json:"fields_default"`
+
+	// DataFixCmd 处理数据的外部程序，每次输入一行数据，输出一行处理后的数据，输出空行时跳过该数据
+	DataFixCmd string `json:"data_fix_cmd"`
+
+	// DeadLetterFile bulk 失败的数据写入该文件，可以使用 -replay 重新写入
+	DeadLetterFile string `json:"dead_letter_file"`
+
+	// BulkRetry bulk 返回 429、503 等状态的数据的重试配置
+	BulkRetry *BulkRetry `json:"bulk_retry"`
+
+	// Bulk 每个 bulk 请求的条数和大小，所有 bulk_worker 处理后的数据重新分组发送
+	Bulk *BulkConfig `json:"bulk"`
+
+	// Throttle 写入限速，收到 SIGHUP 时重新读取配置文件中的 throttle 修改速度
+	Throttle *ThrottleConfig `json:"throttle"`
+
+	// TypePolicy 写入时去掉 _type 的方式：merge、prefix_id、type_field，
+	// 为空且写入的集群不支持 _type 时使用 merge
+	TypePolicy string `json:"type_policy"`
+
+	// TypeField type_policy 为 type_field 时，保存原 _type 的字段名，默认为 type
+	TypeField string `json:"type_field"`
+
+	// PreserveVersion 写入时保留数据中的 _version 作为外部版本号：external、external_gte，为空时不保留
+	PreserveVersion string `json:"preserve_version"`
+
+	// OpType 写入的方式：index(默认)、create、update、delete，
+	// 数据或者 data_fix_cmd 输出的数据中可以使用 _op_type 字段指定每条数据的方式
+	OpType string `json:"op_type"`
+
+	// DocAsUpsert op_type 为 update 时，数据不存在则使用 _source 写入
+	DocAsUpsert bool `json:"doc_as_upsert"`
+
+	// Script op_type 为 update 时使用脚本更新，脚本的 params.doc 为数据的 _source
+	Script map[string]interface{} `json:"script"`
+
+	// Debug 输出 data_fix_cmd 处理前后的数据
+	Debug bool `json:"-"`
+
+	host     *Host
+	doc      *DocType
+	throttle *Throttle
+}
+
+// Init 检查配置并设置默认值，host、doc 为写入的集群和索引，
+// replayFile 为重放的 dead_letter_file，重放时不再调用 data_fix_cmd
+func (c *WriteConfig) Init(host *Host, doc *DocType, replayFile string) error {
+	c.host = host
+	c.doc = doc
+
+	if err := CheckTypePolicy(c.TypePolicy); err != nil {
+		return err
+	}
+	if c.TypePolicy == "" && !host.Vs.Capabilities().Types {
+		c.TypePolicy = TypePolicyMerge
+	}
+	if c.TypePolicy != "" && doc.Type != "" {
+		return fmt.Errorf("new_index.type.type must be empty when type_policy is %q or new_index does not support _type", c.TypePolicy)
+	}
+	if c.TypePolicy == TypePolicyTypeField && c.TypeField == "" {
+		c.TypeField = "type"
+	}
+
+	if c.FieldsDefault == nil {
+		c.FieldsDefault = make(map[string]interface{})
+	}
+	c.DataFixCmd = strings.TrimSpace(c.DataFixCmd)
+	if strings.HasPrefix(c.DataFixCmd, "#") {
+		log.Println("ignore data fix cmd:", c.DataFixCmd)
+		c.DataFixCmd = ""
+	}
+	if replayFile != "" {
+		// dead_letter_file 中的数据已经过 data_fix_cmd 处理，重放时直接写入
+		c.DataFixCmd = ""
+	}
+
+	switch c.PreserveVersion {
+	case "", "external", "external_gte":
+	default:
+		return fmt.Errorf("unknown preserve_version %q, should be one of: external, external_gte", c.PreserveVersion)
+	}
+
+	if err := CheckOpType(c.OpType); err != nil {
+		return err
+	}
+	if c.Script != nil && c.OpType != OpUpdate {
+		return fmt.Errorf("script requires op_type update")
+	}
+
+	if c.BulkRetry == nil {
+		c.BulkRetry = &BulkRetry{}
+	}
+	if err := c.BulkRetry.Init(); err != nil {
+		return err
+	}
+
+	if c.Bulk == nil {
+		c.Bulk = &BulkConfig{}
+	}
+	if err := c.Bulk.Init(); err != nil {
+		return err
+	}
+
+	if c.Throttle == nil {
+		// 不限速，运行中可以通过 SIGHUP 修改
+		c.Throttle = &ThrottleConfig{}
+	}
+	var err error
+	if c.throttle, err = NewThrottle(c.Throttle); err != nil {
+		return err
+	}
+
+	if c.DeadLetterFile != "" {
+		c.DeadLetterFile, _ = filepath.Abs(c.DeadLetterFile)
+		if c.DeadLetterFile == replayFile {
+			return fmt.Errorf("dead_letter_file can not be the same as the replay file")
+		}
+	}
+	return nil
+}
+
+// Throttler 写入限速，需要先调用 Init
+func (c *WriteConfig) Throttler() *Throttle {
+	return c.throttle
+}
+
+// NewBulkWriter 创建 BulkWriter，配置了 dead_letter_file 时打开该文件，需要先调用 Init
+func (c *WriteConfig) NewBulkWriter(counter BulkCounter) (*BulkWriter, error) {
+	w := &BulkWriter{
+		Host:     c.host,
+		Retry:    c.BulkRetry,
+		Throttle: c.throttle,
+		Counter:  counter,
+	}
+	if c.DeadLetterFile != "" {
+		var err error
+		if w.DeadLetter, err = NewDeadLetterWriter(c.DeadLetterFile); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// BulkLine 处理一条数据：依次替换 _index、_type，设置 fields_default，调用 data_fix_cmd，
+// 设置操作类型和版本号，再按 type_policy 去掉 _type，返回 bulk 请求行。
+// changed 为数据是否有变化，跳过该数据时 line 为空。
+// keepSeqNo 为 false 时不写入 _seq_no、_primary_term
+func (c *WriteConfig) BulkLine(item *DataItem, fixer *SubProcess, keepSeqNo bool) (line string, changed bool) {
+	if c.doc.Index != "" {
+		item.Index = c.doc.Index
+	}
+	if c.doc.Type != "" && item.Type != c.doc.Type {
+		item.Type = c.doc.Type
+		changed = true
+	}
+
+	changed = item.SetDefaults(c.FieldsDefault) || changed
+
+	if fixer != nil {
+		raw := string(item.JSONBytes())
+		res, newItem := fixer.FixItem(raw)
+		if res == "" {
+			log.Println("[info] skip with empty resp:", item.UniqID())
+			return "", false
+		}
+		changed = changed || raw != res
+		if c.Debug {
+			fmt.Println("fixer >>>" + strings.Repeat("=", 70))
+			fmt.Println("raw:", raw)
+			fmt.Println("new:", res)
+		}
+		item = newItem
+	}
+
+	// data_fix_cmd 返回的 _op_type 优先
+	if err := item.SetOp(c.OpType, c.DocAsUpsert, c.Script); err != nil {
+		log.Println("[err] skip data:", item.UniqID(), err)
+		return "", false
+	}
+	if item.Op() != OpIndex {
+		changed = true
+	}
+
+	if c.PreserveVersion != "" && item.Version > 0 {
+		item.VersionType = c.PreserveVersion
+	}
+	if !keepSeqNo {
+		item.SeqNo = nil
+		item.PrimaryTerm = 0
+	}
+
+	if c.TypePolicy != "" && item.Type != "" {
+		// merge 只是去掉 _type，写回原索引时数据没有变化
+		changed = changed || c.TypePolicy != TypePolicyMerge
+		item.RemoveType(c.TypePolicy, c.TypeField)
+	}
+	return item.BulkStringFor(c.host.Vs.Capabilities()), changed
+}
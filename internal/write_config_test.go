@@ -0,0 +1,142 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"testing"
+)
+
+func TestWriteConfig_Init(t *testing.T) {
+	tests := []struct {
+		name       string
+		conf       WriteConfig
+		version    string
+		doc        DocType
+		replay     string
+		wantPolicy string
+		wantFixCmd string
+		wantErr    bool
+	}{
+		{name: "es 6 keeps _type", version: "6.8.0"},
+		{name: "es 7 default merge", version: "7.10.0", wantPolicy: TypePolicyMerge},
+		{name: "type with policy", version: "7.10.0", doc: DocType{Type: "_doc"}, wantErr: true},
+		{name: "comment fix cmd", version: "6.8.0", conf: WriteConfig{DataFixCmd: " # cat "}},
+		{name: "fix cmd", version: "6.8.0", conf: WriteConfig{DataFixCmd: " cat "}, wantFixCmd: "cat"},
+		{name: "replay without fix cmd", version: "6.8.0", conf: WriteConfig{DataFixCmd: "cat"}, replay: "/tmp/dl.json"},
+		{name: "replay dead letter", version: "6.8.0", conf: WriteConfig{DeadLetterFile: "/tmp/dl.json"}, replay: "/tmp/dl.json", wantErr: true},
+		{name: "invalid preserve_version", version: "6.8.0", conf: WriteConfig{PreserveVersion: "internal"}, wantErr: true},
+		{name: "script without update", version: "6.8.0", conf: WriteConfig{Script: map[string]interface{}{}}, wantErr: true},
+		{name: "invalid op_type", version: "6.8.0", conf: WriteConfig{OpType: "upsert"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := &Host{Vs: &ResponseVersion{VersionData: map[string]interface{}{"number": tt.version}}}
+			c := tt.conf
+			err := c.Init(host, &tt.doc, tt.replay)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if c.TypePolicy != tt.wantPolicy || c.DataFixCmd != tt.wantFixCmd {
+				t.Errorf("type_policy = %q, data_fix_cmd = %q", c.TypePolicy, c.DataFixCmd)
+			}
+			if c.Throttler() == nil || c.Bulk == nil || c.BulkRetry == nil {
+				t.Error("defaults not set")
+			}
+		})
+	}
+}
+
+func TestWriteConfig_BulkLine(t *testing.T) {
+	const doc = `{"_index":"test","_type":"doc","_id":"1","_version":3,"_seq_no":5,"_primary_term":1,"_source":{"a":1}}`
+	tests := []struct {
+		name        string
+		conf        WriteConfig
+		newDoc      DocType
+		version     string
+		doc         string
+		keepSeqNo   bool
+		want        string
+		wantChanged bool
+	}{
+		{
+			name: "default",
+			want: `{"index":{"_index":"test","_type":"doc","_id":"1"}}` + "\n" + `{"a":1}` + "\n",
+		},
+		{
+			name:        "rename and fields_default",
+			newDoc:      DocType{Index: "test_v2", Type: "_doc"},
+			conf:        WriteConfig{FieldsDefault: map[string]interface{}{"a": 2, "b": "x"}},
+			want:        `{"index":{"_index":"test_v2","_type":"_doc","_id":"1"}}` + "\n" + `{"a":1,"b":"x"}` + "\n",
+			wantChanged: true,
+		},
+		{
+			name:        "type_policy and version",
+			conf:        WriteConfig{TypePolicy: TypePolicyPrefixID, PreserveVersion: "external"},
+			version:     "8.1.0",
+			want:        `{"index":{"_index":"test","_id":"doc-1","version":3,"version_type":"external"}}` + "\n" + `{"a":1}` + "\n",
+			wantChanged: true,
+		},
+		{
+			name:    "merge on typeless",
+			version: "7.10.2",
+			doc:     `{"_index":"test","_type":"_doc","_id":"1","_source":{"a":1}}`,
+			want:    `{"index":{"_index":"test","_id":"1"}}` + "\n" + `{"a":1}` + "\n",
+		},
+		{
+			name:        "type_field on typeless",
+			conf:        WriteConfig{TypePolicy: TypePolicyTypeField},
+			version:     "7.10.2",
+			doc:         `{"_index":"test","_type":"_doc","_id":"1","_source":{"a":1}}`,
+			want:        `{"index":{"_index":"test","_id":"1"}}` + "\n" + `{"a":1,"type":"_doc"}` + "\n",
+			wantChanged: true,
+		},
+		{
+			name:        "rename type",
+			newDoc:      DocType{Type: "doc2"},
+			want:        `{"index":{"_index":"test","_type":"doc2","_id":"1"}}` + "\n" + `{"a":1}` + "\n",
+			wantChanged: true,
+		},
+		{
+			name:      "keep seq_no",
+			keepSeqNo: true,
+			want:      `{"index":{"_index":"test","_type":"doc","_id":"1","if_seq_no":5,"if_primary_term":1}}` + "\n" + `{"a":1}` + "\n",
+		},
+		{
+			name:        "op_type from data",
+			conf:        WriteConfig{OpType: OpCreate},
+			doc:         `{"_index":"test","_id":"1","_op_type":"delete"}`,
+			want:        `{"delete":{"_index":"test","_id":"1"}}` + "\n",
+			wantChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.version == "" {
+				tt.version = "6.8.0"
+			}
+			if tt.doc == "" {
+				tt.doc = doc
+			}
+			host := &Host{Vs: &ResponseVersion{VersionData: map[string]interface{}{"number": tt.version}}}
+			c := tt.conf
+			if err := c.Init(host, &tt.newDoc, ""); err != nil {
+				t.Fatal(err)
+			}
+			item, err := NewDataItem(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, changed := c.BulkLine(item, nil, tt.keepSeqNo)
+			if got != tt.want || changed != tt.wantChanged {
+				t.Errorf("BulkLine() = %q, %v, want %q, %v", got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// WriteCounter es_reindex、es_load 共用的读取和写入计数器，可并发调用
+type WriteCounter struct {
+	start     time.Time
+	read      uint64 // 已读取的条数
+	writeSkip uint64
+	writeBulk uint64
+	bulkC     uint64
+	bulkFail  uint64 // bulk 失败的条数
+	bulkRetry uint64 // bulk 重试的条数
+}
+
+// NewWriteCounter 创建计数器，从当前时间开始计时
+func NewWriteCounter() *WriteCounter {
+	return &WriteCounter{
+		start: time.Now(),
+	}
+}
+
+// Summary 写入的计数，用于拼接日志
+func (c *WriteCounter) Summary() string {
+	return fmt.Sprintf("skip=%d bulk_no=%d bulk_total=%d bulk_fail=%d bulk_retry=%d",
+		atomic.LoadUint64(&c.writeSkip), atomic.LoadUint64(&c.bulkC), atomic.LoadUint64(&c.writeBulk),
+		atomic.LoadUint64(&c.bulkFail), atomic.LoadUint64(&c.bulkRetry))
+}
+
+// Elapsed 已运行的时间
+func (c *WriteCounter) Elapsed() time.Duration {
+	return time.Since(c.start)
+}
+
+// AddRead 记录读取到的条数
+func (c *WriteCounter) AddRead(num int) {
+	atomic.AddUint64(&c.read, uint64(num))
+}
+
+// Read 已读取的条数
+func (c *WriteCounter) Read() uint64 {
+	return atomic.LoadUint64(&c.read)
+}
+
+// AddWrite 记录交给 bulk 写入的条数和跳过的条数
+func (c *WriteCounter) AddWrite(write int, skip int) {
+	atomic.AddUint64(&c.writeBulk, uint64(write))
+	atomic.AddUint64(&c.writeSkip, uint64(skip))
+}
+
+// AddBulk 记录 bulk 写入的结果，create 时已存在的数据计入 skip
+func (c *WriteCounter) AddBulk(done int, fail int, retry int, exists int) {
+	atomic.AddUint64(&c.bulkC, uint64(done))
+	atomic.AddUint64(&c.bulkFail, uint64(fail))
+	atomic.AddUint64(&c.bulkRetry, uint64(retry))
+	atomic.AddUint64(&c.writeSkip, uint64(exists))
+}
+
+// Values 用于保存到断点文件、输出状态的计数器
+func (c *WriteCounter) Values() map[string]uint64 {
+	return map[string]uint64{
+		"read":       atomic.LoadUint64(&c.read),
+		"write_skip": atomic.LoadUint64(&c.writeSkip),
+		"write_bulk": atomic.LoadUint64(&c.writeBulk),
+		"bulk_c":     atomic.LoadUint64(&c.bulkC),
+		"bulk_fail":  atomic.LoadUint64(&c.bulkFail),
+		"bulk_retry": atomic.LoadUint64(&c.bulkRetry),
+	}
+}
+
+// Restore 从断点恢复已读取的条数，read 为断点中已确认的条数。
+// 断点中保存的写入计数包含了断点之后处理中的页，恢复后会重复计数，所以写入计数从 0 开始
+func (c *WriteCounter) Restore(read uint64) {
+	atomic.StoreUint64(&c.read, read)
+}
+
+// LogProgress 输出计数器，need >= 0 时附带完成的百分比和预计完成的时间
+func LogProgress(counter fmt.Stringer, finishRate float64, need float64) {
+	if need < 0 {
+		log.Println(counter)
+		return
+	}
+	finishTime := time.Now().Add(time.Duration(need) * time.Second)
+	log.Printf("%s rate=%.2f%% need=%.1fs finish_time=%s", counter, 100*finishRate, need, finishTime.Format("2006-01-02 15:04:05"))
+}
@@ -0,0 +1,34 @@
+/*
+ * Copyright(C) 2020 github.com/hidu  All Rights Reserved.
+ * Author: hidu (duv123+git@baidu.com)
+ * Date: 2026/10/18
+ */
+
+package internal
+
+import (
+	"testing"
+)
+
+func TestWriteCounter_Restore(t *testing.T) {
+	c := NewWriteCounter()
+	c.AddRead(10)
+	c.AddWrite(8, 2)
+	c.AddBulk(7, 1, 3, 1)
+
+	want := "skip=3 bulk_no=7 bulk_total=8 bulk_fail=1 bulk_retry=3"
+	if got := c.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+
+	// 断点之后处理中的页会重新写入，只恢复已读取的条数
+	r := NewWriteCounter()
+	r.Restore(6)
+	if r.Read() != 6 {
+		t.Errorf("Read() = %d, want 6", r.Read())
+	}
+	want = "skip=0 bulk_no=0 bulk_total=0 bulk_fail=0 bulk_retry=0"
+	if got := r.Summary(); got != want {
+		t.Errorf("restored Summary() = %q, want %q", got, want)
+	}
+}